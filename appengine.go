@@ -1,10 +1,49 @@
 package ipcat
 
 import (
+	"bytes"
+	"context"
 	"net"
 	"strings"
 )
 
+const (
+	appEngineName = "Google App Engine"
+	appEngineURL  = "https://cloud.google.com/appengine"
+)
+
+// AppEngineProvider is the Provider for Google App Engine.  The raw
+// data is one CIDR range per line.
+//
+// Deprecated: Google no longer maintains the SPF records this walks.
+// Use GoogleCloudProvider, which covers App Engine too.
+type AppEngineProvider struct{}
+
+// Name satisfies the Provider interface
+func (AppEngineProvider) Name() string { return appEngineName }
+
+// URL satisfies the Provider interface
+func (AppEngineProvider) URL() string { return appEngineURL }
+
+// Fetch satisfies the Provider interface.  The ranges are looked up
+// in DNS, so the Fetcher is not used.
+func (AppEngineProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	ranges, err := DownloadAppEngine()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(ranges, "\n")), nil
+}
+
+// Update satisfies the Provider interface
+func (AppEngineProvider) Update(ipmap *IntervalSet, body []byte) error {
+	var ranges []string
+	for _, line := range bytes.Fields(body) {
+		ranges = append(ranges, string(line))
+	}
+	return UpdateAppEngine(ipmap, ranges)
+}
+
 func lookupSPFRecord(name string, f func(dir string) error) error {
 	txt, err := net.LookupTXT(name)
 	if err != nil {
@@ -29,6 +68,8 @@ func lookupSPFRecord(name string, f func(dir string) error) error {
 
 // DownloadAppEngine downloads and returns raw bytes of the Google App Engine ip
 // range list
+//
+// Deprecated: use DownloadGoogleCloud.
 func DownloadAppEngine() ([]string, error) {
 	var ranges []string
 	if err := lookupSPFRecord("_cloud-netblocks.googleusercontent.com", func(dir string) error {
@@ -52,17 +93,14 @@ func DownloadAppEngine() ([]string, error) {
 }
 
 // UpdateAppEngine takes a raw data, parses it and updates the ipmap
+//
+// Deprecated: use UpdateGoogleCloud.
 func UpdateAppEngine(ipmap *IntervalSet, ranges []string) error {
-	const (
-		dcName = "Google App Engine"
-		dcURL  = "https://cloud.google.com/appengine"
-	)
-
 	// delete all existing records
-	ipmap.DeleteByName(dcName)
+	ipmap.DeleteByName(appEngineName)
 
 	for _, ipRange := range ranges {
-		err := ipmap.AddCIDR(ipRange, dcName, dcURL)
+		err := ipmap.AddCIDR(ipRange, appEngineName, appEngineURL)
 		if err != nil {
 			return err
 		}
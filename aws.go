@@ -1,73 +1,161 @@
 package ipcat
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
+	"strings"
 )
 
 var (
 	awsDownload = "https://ip-ranges.amazonaws.com/ip-ranges.json"
 )
 
-// AWSPrefix is AWS prefix in their IP ranges file
+const (
+	awsName = "Amazon AWS"
+	awsURL  = "http://www.amazon.com/aws/"
+)
+
+func init() {
+	Register("aws", AWSProvider{})
+}
+
+// AWSProvider is the Provider for Amazon AWS
+type AWSProvider struct {
+	// Services limits the update to these services, such as "EC2"
+	// or "CLOUDFRONT".  Empty means all services.
+	Services []string
+}
+
+// Name satisfies the Provider interface
+func (AWSProvider) Name() string { return awsName }
+
+// URL satisfies the Provider interface
+func (AWSProvider) URL() string { return awsURL }
+
+// Fetch satisfies the Provider interface
+func (AWSProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, awsDownload)
+}
+
+// Update satisfies the Provider interface
+func (p AWSProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateAWSServices(ipmap, body, p.Services)
+}
+
+// AWSPrefix is AWS prefix in their IP ranges file.  IPv6Prefix is
+// set instead of IPPrefix in the ipv6_prefixes list.
 type AWSPrefix struct {
-	IPPrefix string `json:"ip_prefix"`
-	Region   string `json:"region"`
-	Service  string `json:"service"`
+	IPPrefix           string `json:"ip_prefix"`
+	IPv6Prefix         string `json:"ipv6_prefix"`
+	Region             string `json:"region"`
+	Service            string `json:"service"`
+	NetworkBorderGroup string `json:"network_border_group"`
 }
 
 // AWS is main record for AWS IP info
 type AWS struct {
-	SyncToken  string      `json:"syncToken"`
-	CreateDate string      `json:"createDate"`
-	Prefixes   []AWSPrefix `json:"prefixes"`
+	SyncToken    string      `json:"syncToken"`
+	CreateDate   string      `json:"createDate"`
+	Prefixes     []AWSPrefix `json:"prefixes"`
+	IPv6Prefixes []AWSPrefix `json:"ipv6_prefixes"`
 }
 
 // DownloadAWS downloads the latest AWS IP ranges list
 func DownloadAWS() ([]byte, error) {
-	resp, err := http.Get(awsDownload)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Failed to download AWS ranges: status code %s", resp.Status)
-	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	resp.Body.Close()
-	return body, nil
-
+	return AWSProvider{}.Fetch(context.Background(), nil)
 }
 
 // UpdateAWS parses the AWS IP json file and updates the interval set
+// with the ranges of every service
 func UpdateAWS(ipmap *IntervalSet, body []byte) error {
-	const (
-		awsName = "Amazon AWS"
-		awsURL  = "http://www.amazon.com/aws/"
-	)
+	return UpdateAWSServices(ipmap, body, nil)
+}
 
+// awsServiceRank orders services when one prefix is listed under
+// several.  AMAZON is the superset of all others and EC2 includes
+// several narrower services, so anything else is more specific.
+func awsServiceRank(service string) int {
+	switch service {
+	case "AMAZON":
+		return 0
+	case "EC2":
+		return 1
+	}
+	return 2
+}
+
+// UpdateAWSServices parses the AWS IP json file, IPv4 and IPv6, and
+// updates the interval set with the ranges of the given services, or
+// all services if none are given.  Each prefix is tagged with its most
+// specific service, so AMAZON only remains for prefixes not listed
+// under any other service.  The network border group is recorded as
+// the region, since it is the region or a more specific local zone.
+func UpdateAWSServices(ipmap *IntervalSet, body []byte, services []string) error {
 	aws := AWS{}
 	err := json.Unmarshal(body, &aws)
 	if err != nil {
 		return err
 	}
 
-	// delete all existing records
-	ipmap.DeleteByName(awsName)
+	wanted := func(service string) bool {
+		if len(services) == 0 {
+			return true
+		}
+		for _, s := range services {
+			if s == service {
+				return true
+			}
+		}
+		return false
+	}
 
-	// and add back
-	for _, rec := range aws.Prefixes {
-		if rec.Service == "EC2" {
-			err := ipmap.AddCIDR(rec.IPPrefix, awsName, awsURL)
-			if err != nil {
-				return err
+	best := make(map[string]*AWSPrefix)
+	var order []string
+	for _, list := range [][]AWSPrefix{aws.Prefixes, aws.IPv6Prefixes} {
+		for i := range list {
+			rec := &list[i]
+			if !wanted(rec.Service) {
+				continue
+			}
+			cidr := rec.IPPrefix
+			if cidr == "" {
+				cidr = rec.IPv6Prefix
+			}
+			cur, ok := best[cidr]
+			if !ok {
+				order = append(order, cidr)
 			}
+			if !ok || awsServiceRank(rec.Service) > awsServiceRank(cur.Service) {
+				best[cidr] = rec
+			}
+		}
+	}
+
+	tmp := NewIntervalSet(len(order))
+	for _, cidr := range order {
+		rec := best[cidr]
+		region := rec.NetworkBorderGroup
+		if region == "" {
+			region = rec.Region
+		}
+		category := CategoryCloud
+		if strings.HasPrefix(rec.Service, "CLOUDFRONT") {
+			category = CategoryCDN
+		}
+		err := tmp.AddCIDRMeta(cidr, awsName, awsURL, Metadata{
+			Category: category,
+			Region:   region,
+			Service:  rec.Service,
+			Source:   "aws",
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	return nil
+	// delete all existing records
+	ipmap.DeleteByName(awsName)
+
+	// and add back
+	return addResolved(ipmap, tmp)
 }
@@ -1,7 +1,6 @@
 package ipcat
 
 import (
-	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -9,24 +8,7 @@ import (
 
 func TestAWS(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, `
-		{
-			"syncToken": "0123456789",
-			"createDate": "2016-11-30-23-19-08",
-			"prefixes": [
-				{
-				  "ip_prefix": "216.182.224.0/20",
-				  "region": "us-east-1",
-				  "service": "AMAZON"
-				},
-				{
-				  "ip_prefix": "13.54.0.0/15",
-				  "region": "ap-southeast-2",
-				  "service": "EC2"
-				}
-			]
-		}`)
-
+		http.ServeFile(w, r, "testdata/aws.json")
 	}))
 	awsDownload = ts.URL
 	defer ts.Close()
@@ -39,19 +21,60 @@ func TestAWS(t *testing.T) {
 	if err != nil {
 		t.Fatalf("UpdateAWS error: %v", err)
 	}
-	// UpdateAWS should only add EC2 IP ranges
-	rec, err := ipset.Contains("216.182.224.0")
-	if err != nil {
-		t.Fatalf("ipset.Contains(%q) error: %v", "216.182.224.0", err)
+
+	tests := []struct {
+		ip       string
+		service  string
+		region   string
+		category Category
+	}{
+		// only listed under AMAZON
+		{"216.182.224.0", "AMAZON", "us-east-1", CategoryCloud},
+		// AMAZON superset entry is replaced by the specific service
+		{"13.54.0.1", "EC2", "ap-southeast-2", CategoryCloud},
+		{"15.181.232.1", "EC2", "us-east-1-bos-1", CategoryCloud},
+		{"52.84.0.1", "CLOUDFRONT", "GLOBAL", CategoryCDN},
+		{"2600:1f14::1", "EC2", "us-west-2", CategoryCloud},
+		// nested inside the EC2 range
+		{"2600:1f14:fff:f800::1", "ROUTE53_HEALTHCHECKS", "us-west-2", CategoryCloud},
 	}
-	if rec != nil {
-		t.Errorf("ipset.Contains(%q) rec = %v, want nil", "216.182.224.0", rec)
+	for _, tt := range tests {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Service != tt.service || rec.Region != tt.region || rec.Category != tt.category {
+			t.Errorf("ipset.Contains(%q) = %q %q %q, want %q %q %q", tt.ip,
+				rec.Service, rec.Region, rec.Category, tt.service, tt.region, tt.category)
+		}
 	}
-	rec, err = ipset.Contains("13.54.0.1")
-	if err != nil {
-		t.Fatalf("ipset.Contains(%q) error: %v", "13.54.0.0", err)
+}
+
+func TestAWSServiceFilter(t *testing.T) {
+	ipset := NewIntervalSet(100)
+	p := AWSProvider{Services: []string{"EC2"}}
+	if err := p.Update(ipset, mustReadFile(t, "testdata/aws.json")); err != nil {
+		t.Fatalf("Update error: %v", err)
 	}
-	if rec == nil {
-		t.Errorf("ipset.Contains(%q) rec = nil, want exists", "13.54.0.0")
+	for ip, want := range map[string]bool{
+		"216.182.224.0": false,
+		"52.84.0.1":     false,
+		"13.54.0.1":     true,
+		"2600:1f14::1":  true,
+	} {
+		rec, err := ipset.Contains(ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", ip, err)
+		}
+		if (rec != nil) != want {
+			t.Errorf("ipset.Contains(%q) = %v, want found %v", ip, rec, want)
+		}
+		if rec != nil && rec.Service != "EC2" {
+			t.Errorf("ipset.Contains(%q) service = %q, want EC2", ip, rec.Service)
+		}
 	}
 }
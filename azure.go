@@ -1,12 +1,12 @@
 package ipcat
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"regexp"
 )
 
@@ -26,32 +26,83 @@ type AzurePublicIPAddresses struct {
 	AzureRegion []AzureRegion `xml:"Region"`
 }
 
-var retried bool
+const (
+	azureName = "Microsoft Azure"
+	azureURL  = "http://www.windowsazure.com/en-us/"
+)
 
-var findPublicIPsURL = func() (string, error) {
-	downloadPage := "http://www.microsoft.com/en-us/download/confirmation.aspx?id=41653"
+func init() {
+	Register("azure", AzureProvider{})
+}
+
+// AzureProvider is the Provider for Microsoft Azure, using the Service
+// Tags JSON document
+type AzureProvider struct {
+	// DownloadPage is the page linking to the current
+	// ServiceTags_Public_*.json file.  Empty means the Microsoft
+	// download page.
+	DownloadPage string
+}
+
+// Name satisfies the Provider interface
+func (AzureProvider) Name() string { return azureName }
 
-	resp, err := http.Get(downloadPage)
+// URL satisfies the Provider interface
+func (AzureProvider) URL() string { return azureURL }
+
+// Fetch satisfies the Provider interface
+func (p AzureProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	downloadPage := p.DownloadPage
+	if downloadPage == "" {
+		downloadPage = azureServiceTagsPage
+	}
+	url, err := findDownloadLink(ctx, f, downloadPage, azureServiceTagsRe)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	b, err := ioutil.ReadAll(resp.Body)
+	return f.Get(ctx, url)
+}
+
+// Update satisfies the Provider interface.  Both the Service Tags JSON
+// and the retired PublicIPs XML format are accepted.
+func (AzureProvider) Update(ipmap *IntervalSet, body []byte) error {
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '<' {
+		return UpdateAzure(ipmap, body)
+	}
+	return UpdateAzureServiceTags(ipmap, body)
+}
+
+// findDownloadLink fetches a download page and returns the first link
+// matching re
+func findDownloadLink(ctx context.Context, f *Fetcher, downloadPage string, re *regexp.Regexp) (string, error) {
+	b, err := f.Get(ctx, downloadPage)
 	if err != nil {
 		return "", err
 	}
+	m := re.FindSubmatch(b)
+	if m == nil {
+		return "", fmt.Errorf("could not find download link on %s", downloadPage)
+	}
+	return string(m[len(m)-1]), nil
+}
 
-	re := regexp.MustCompile("url=https://download.microsoft.com/download/.*/PublicIPs_.*.xml")
-	addr := re.Find(b)
+var retried bool
 
-	if string(addr) == "" {
+var findPublicIPsURL = func() (string, error) {
+	downloadPage := "http://www.microsoft.com/en-us/download/confirmation.aspx?id=41653"
+	re := regexp.MustCompile("url=(https://download.microsoft.com/download/.*/PublicIPs_.*.xml)")
+	addr, err := findDownloadLink(context.Background(), nil, downloadPage, re)
+	if err != nil {
 		return "", errors.New("could not find PublicIPs address on download page")
 	}
-
-	return string(addr)[4:], nil
+	return addr, nil
 }
 
 // DownloadAzure downloads and returns raw bytes of the MS Azure ip
 // range list
+//
+// Deprecated: Microsoft retired the PublicIPs XML file, use
+// DownloadAzureServiceTags.
 func DownloadAzure() ([]byte, error) {
 	url, err := findPublicIPsURL()
 	if err != nil {
@@ -59,26 +110,13 @@ func DownloadAzure() ([]byte, error) {
 	}
 
 	log.Printf("Attempting ip range download with url %s...", url)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("unable read body: %s", err)
-	}
-	resp.Body.Close()
-	return body, nil
+	return DefaultFetcher.Get(context.Background(), url)
 }
 
 // UpdateAzure takes a raw data, parses it and updates the ipmap
+//
+// Deprecated: use UpdateAzureServiceTags.
 func UpdateAzure(ipmap *IntervalSet, body []byte) error {
-	const (
-		dcName = "Microsoft Azure"
-		dcURL  = "http://www.windowsazure.com/en-us/"
-	)
-
 	azure := AzurePublicIPAddresses{}
 	err := xml.Unmarshal(body, &azure)
 	if err != nil {
@@ -86,11 +124,15 @@ func UpdateAzure(ipmap *IntervalSet, body []byte) error {
 	}
 
 	// delete all existing records
-	ipmap.DeleteByName(dcName)
+	ipmap.DeleteByName(azureName)
 
 	for _, region := range azure.AzureRegion {
 		for _, rng := range region.IPRange {
-			err = ipmap.AddCIDR(rng.Subnet, dcName, dcURL)
+			err = ipmap.AddCIDRMeta(rng.Subnet, azureName, azureURL, Metadata{
+				Category: CategoryCloud,
+				Region:   region.Name,
+				Source:   "azure",
+			})
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,104 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+)
+
+var (
+	azureServiceTagsPage = "https://www.microsoft.com/en-us/download/details.aspx?id=56519"
+	azureServiceTagsRe   = regexp.MustCompile(`https?://[^"'\s<>]+/ServiceTags_Public_[0-9]+\.json`)
+)
+
+// AzureServiceTagProperties are the properties of a service tag
+type AzureServiceTagProperties struct {
+	ChangeNumber    int      `json:"changeNumber"`
+	Region          string   `json:"region"`
+	RegionID        int      `json:"regionId"`
+	Platform        string   `json:"platform"`
+	SystemService   string   `json:"systemService"`
+	AddressPrefixes []string `json:"addressPrefixes"`
+	NetworkFeatures []string `json:"networkFeatures"`
+}
+
+// AzureServiceTag is one service tag, such as "AzureCloud.eastus" or
+// "Storage"
+type AzureServiceTag struct {
+	Name       string                    `json:"name"`
+	ID         string                    `json:"id"`
+	Properties AzureServiceTagProperties `json:"properties"`
+}
+
+// AzureServiceTags is the main record of the Service Tags JSON document
+type AzureServiceTags struct {
+	ChangeNumber int               `json:"changeNumber"`
+	Cloud        string            `json:"cloud"`
+	Values       []AzureServiceTag `json:"values"`
+}
+
+// DownloadAzureServiceTags finds the current Service Tags JSON file on
+// the download page and returns its raw bytes.  An empty downloadPage
+// means the Microsoft download page.
+func DownloadAzureServiceTags(downloadPage string) ([]byte, error) {
+	return AzureProvider{DownloadPage: downloadPage}.Fetch(context.Background(), nil)
+}
+
+// UpdateAzureServiceTags parses the Service Tags JSON document and
+// updates the interval set.  The same prefix is listed under several
+// tags, such as AzureCloud, AzureCloud.eastus and Storage.EastUS, so
+// each prefix is tagged with its most detailed tag, and where prefixes
+// nest the more specific one wins.
+func UpdateAzureServiceTags(ipmap *IntervalSet, body []byte) error {
+	tags := AzureServiceTags{}
+	err := json.Unmarshal(body, &tags)
+	if err != nil {
+		return err
+	}
+
+	// pick the most detailed tag for each prefix
+	type tagged struct {
+		score int
+		props *AzureServiceTagProperties
+	}
+	best := make(map[string]tagged)
+	var order []string
+	for i := range tags.Values {
+		props := &tags.Values[i].Properties
+		score := 0
+		if props.Region != "" {
+			score++
+		}
+		if props.SystemService != "" {
+			score += 2
+		}
+		for _, cidr := range props.AddressPrefixes {
+			cur, ok := best[cidr]
+			if !ok {
+				order = append(order, cidr)
+			}
+			if !ok || score > cur.score {
+				best[cidr] = tagged{score: score, props: props}
+			}
+		}
+	}
+
+	tmp := NewIntervalSet(len(order))
+	for _, cidr := range order {
+		props := best[cidr].props
+		err := tmp.AddCIDRMeta(cidr, azureName, azureURL, Metadata{
+			Category: CategoryCloud,
+			Region:   props.Region,
+			Service:  props.SystemService,
+			Source:   "azure",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(azureName)
+
+	return addResolved(ipmap, tmp)
+}
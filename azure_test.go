@@ -1,6 +1,7 @@
 package ipcat
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -44,3 +45,53 @@ func TestAzure(t *testing.T) {
 		t.Errorf("ipset.Contains(%q) rec = nil, want exists", "23.96.0.0")
 	}
 }
+
+func TestAzureServiceTags(t *testing.T) {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><a href="%s/files/ServiceTags_Public_20240101.json">download</a></html>`, ts.URL)
+	})
+	mux.Handle("/files/", http.StripPrefix("/files/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/azure.json")
+	})))
+
+	p := AzureProvider{DownloadPage: ts.URL + "/download"}
+	b, err := p.Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	if err := p.Update(ipset, b); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		ip      string
+		region  string
+		service string
+	}{
+		{"13.64.1.1", "", ""},
+		{"20.42.0.1", "eastus", "AzureStorage"},
+		{"20.42.1.1", "eastus", ""},
+		{"2603:1030::1", "eastus", ""},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Region != tt.region || rec.Service != tt.service {
+			t.Errorf("ipset.Contains(%q) region, service = %q, %q, want %q, %q",
+				tt.ip, rec.Region, rec.Service, tt.region, tt.service)
+		}
+	}
+
+	if _, err := (AzureProvider{DownloadPage: ts.URL + "/missing"}).Fetch(context.Background(), nil); err == nil {
+		t.Errorf("Fetch() with a missing download page did not return an error")
+	}
+}
@@ -0,0 +1,369 @@
+package ipcat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// ASN based expansion of provider ranges from BGP routing tables.  A
+// provider is mapped to the ASNs it originates routes from, and every
+// prefix seen originated by one of them is added under its name.
+
+// ASNOwner is the provider records are added under for an ASN
+type ASNOwner struct {
+	Name string
+	URL  string
+}
+
+// ParseASNMap reads a mapping of ASNs to providers, one provider per
+// line, in the form
+//
+//	name,url,ASN,...
+//
+// such as "Hetzner Online AG,https://www.hetzner.com/,AS24940".  Lines
+// starting with # are comments.
+func ParseASNMap(in io.Reader) (map[uint32]ASNOwner, error) {
+	r := csv.NewReader(in)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	owners := make(map[uint32]ASNOwner)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected name,url,ASN... but got %v", line, record)
+		}
+		for _, s := range record[2:] {
+			if strings.TrimSpace(s) == "" {
+				continue
+			}
+			asn, err := parseASN(s)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			if prev, ok := owners[asn]; ok && prev.Name != record[0] {
+				return nil, fmt.Errorf("line %d: AS%d already mapped to %s", line, asn, prev.Name)
+			}
+			owners[asn] = ASNOwner{Name: record[0], URL: record[1]}
+		}
+	}
+	return owners, nil
+}
+
+// ASNExpander collects the prefixes originated by mapped ASNs from
+// MRT RIB dumps or prefix tables
+type ASNExpander struct {
+	owners map[uint32]ASNOwner
+	routes *IntervalSet
+	seen   map[asnRoute]bool
+
+	// Skipped counts mapped prefixes that could not be added, such as
+	// prefixes larger than an IPv4 /8
+	Skipped int
+}
+
+// asnRoute is a prefix originated by an ASN
+type asnRoute struct {
+	prefix netip.Prefix
+	asn    uint32
+}
+
+// NewASNExpander returns an expander for the ASN mapping
+func NewASNExpander(owners map[uint32]ASNOwner) *ASNExpander {
+	return &ASNExpander{
+		owners: owners,
+		routes: NewIntervalSet(1000),
+		seen:   make(map[asnRoute]bool),
+	}
+}
+
+// add records a prefix if its origin is mapped
+func (e *ASNExpander) add(p netip.Prefix, asn uint32) {
+	owner, ok := e.owners[asn]
+	if !ok {
+		return
+	}
+	p = p.Masked()
+	if e.seen[asnRoute{p, asn}] {
+		return
+	}
+	e.seen[asnRoute{p, asn}] = true
+	err := e.routes.AddPrefixMeta(p, owner.Name, owner.URL, Metadata{
+		Category: CategoryHosting,
+		ASN:      asn,
+		Source:   "bgp",
+	})
+	if err != nil {
+		e.Skipped++
+	}
+}
+
+// Read reads an MRT RIB dump or a prefix table, telling them apart by
+// the zero bytes of the MRT header
+func (e *ASNExpander) Read(in io.Reader) error {
+	r := bufio.NewReader(in)
+	head, _ := r.Peek(mrtHeaderLen)
+	for _, b := range head {
+		if b == 0 {
+			return e.ReadMRT(r)
+		}
+	}
+	return e.ReadPrefixTable(r)
+}
+
+// ReadPrefixTable reads a text table of prefixes and origin ASNs, one
+// per line, either "192.0.2.0/24 64496" or as in CAIDA's pfx2as files
+// "192.0.2.0 24 64496".  Routes with several origins may list them
+// separated by "_" or ",".  Lines starting with # are comments.
+func (e *ASNExpander) ReadPrefixTable(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	line := 0
+	for scanner.Scan() {
+		line++
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 || f[0][0] == '#' {
+			continue
+		}
+		if len(f) == 3 {
+			f = []string{f[0] + "/" + f[1], f[2]}
+		}
+		if len(f) != 2 {
+			return fmt.Errorf("line %d: expected prefix and ASN but got %q", line, scanner.Text())
+		}
+		p, err := netip.ParsePrefix(f[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		for _, s := range strings.FieldsFunc(f[1], func(r rune) bool { return r == '_' || r == ',' }) {
+			asn, err := parseASN(s)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+			e.add(p, asn)
+		}
+	}
+	return scanner.Err()
+}
+
+// MRT, see RFC 6396 and RFC 8050 for the ADDPATH subtypes
+const (
+	mrtHeaderLen   = 12
+	mrtTableDumpV2 = 13
+
+	mrtRIBIPv4Unicast        = 2
+	mrtRIBIPv6Unicast        = 4
+	mrtRIBIPv4UnicastAddPath = 8
+	mrtRIBIPv6UnicastAddPath = 10
+
+	bgpAttrExtendedLength = 0x10
+	bgpAttrASPath         = 2
+	bgpASSet              = 1
+	bgpASSequence         = 2
+)
+
+// errMRTFormat is returned for malformed MRT data
+var errMRTFormat = errors.New("ipcat: invalid MRT data")
+
+// ReadMRT reads an MRT TABLE_DUMP_V2 RIB dump, such as the bview and
+// rib files of RIPE RIS and RouteViews once decompressed.  The origin
+// of a route is the last ASN of its AS_PATH.  Records other than IPv4
+// and IPv6 unicast RIB entries are skipped.
+func (e *ASNExpander) ReadMRT(in io.Reader) error {
+	header := make([]byte, mrtHeaderLen)
+	var body []byte
+	for {
+		_, err := io.ReadFull(in, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errMRTFormat
+		}
+		typ := binary.BigEndian.Uint16(header[4:])
+		subtype := binary.BigEndian.Uint16(header[6:])
+		n := binary.BigEndian.Uint32(header[8:])
+		if n > 1<<24 {
+			return errMRTFormat
+		}
+		if cap(body) < int(n) {
+			body = make([]byte, n)
+		}
+		body = body[:n]
+		if _, err := io.ReadFull(in, body); err != nil {
+			return errMRTFormat
+		}
+		if typ != mrtTableDumpV2 {
+			continue
+		}
+		switch subtype {
+		case mrtRIBIPv4Unicast, mrtRIBIPv4UnicastAddPath:
+			err = e.readRIB(body, 4, subtype == mrtRIBIPv4UnicastAddPath)
+		case mrtRIBIPv6Unicast, mrtRIBIPv6UnicastAddPath:
+			err = e.readRIB(body, 16, subtype == mrtRIBIPv6UnicastAddPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readRIB reads a RIB entry record
+func (e *ASNExpander) readRIB(b []byte, addrLen int, addPath bool) error {
+	if len(b) < 5 {
+		return errMRTFormat
+	}
+	bits := int(b[4])
+	size := (bits + 7) / 8
+	if bits > addrLen*8 || len(b) < 5+size+2 {
+		return errMRTFormat
+	}
+	var raw [16]byte
+	copy(raw[:], b[5:5+size])
+	var addr netip.Addr
+	if addrLen == 4 {
+		addr = netip.AddrFrom4([4]byte(raw[:4]))
+	} else {
+		addr = netip.AddrFrom16(raw)
+	}
+	p := netip.PrefixFrom(addr, bits)
+	b = b[5+size:]
+	count := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+
+	entryHeader := 2 + 4 + 2
+	if addPath {
+		entryHeader += 4
+	}
+	for i := 0; i < count; i++ {
+		if len(b) < entryHeader {
+			return errMRTFormat
+		}
+		n := int(binary.BigEndian.Uint16(b[entryHeader-2:]))
+		if len(b) < entryHeader+n {
+			return errMRTFormat
+		}
+		asn, ok, err := bgpOrigin(b[entryHeader : entryHeader+n])
+		if err != nil {
+			return err
+		}
+		if ok {
+			e.add(p, asn)
+		}
+		b = b[entryHeader+n:]
+	}
+	return nil
+}
+
+// bgpOrigin returns the origin ASN from BGP path attributes.  There is
+// none if the path is empty or ends in an AS_SET of several ASNs.
+func bgpOrigin(attrs []byte) (uint32, bool, error) {
+	for len(attrs) > 0 {
+		if len(attrs) < 3 {
+			return 0, false, errMRTFormat
+		}
+		flags, typ := attrs[0], attrs[1]
+		n, hdr := int(attrs[2]), 3
+		if flags&bgpAttrExtendedLength != 0 {
+			if len(attrs) < 4 {
+				return 0, false, errMRTFormat
+			}
+			n, hdr = int(binary.BigEndian.Uint16(attrs[2:])), 4
+		}
+		if len(attrs) < hdr+n {
+			return 0, false, errMRTFormat
+		}
+		val := attrs[hdr : hdr+n]
+		attrs = attrs[hdr+n:]
+		if typ != bgpAttrASPath {
+			continue
+		}
+
+		// TABLE_DUMP_V2 always uses 4 byte ASNs
+		var origin uint32
+		ok := false
+		for len(val) > 0 {
+			if len(val) < 2 || len(val) < 2+4*int(val[1]) {
+				return 0, false, errMRTFormat
+			}
+			segType, segLen := val[0], int(val[1])
+			seg := val[2 : 2+4*segLen]
+			val = val[2+4*segLen:]
+			ok = segLen > 0 && (segType == bgpASSequence || segType == bgpASSet && segLen == 1)
+			if ok {
+				origin = binary.BigEndian.Uint32(seg[4*(segLen-1):])
+			}
+		}
+		return origin, ok, nil
+	}
+	return 0, false, nil
+}
+
+// Update replaces the records of every mapped provider in ipmap with
+// the union of its existing records and the collected prefixes.
+// Overlapping prefixes of the same provider are joined rather than
+// treated as conflicts, keeping the metadata of the first.
+func (e *ASNExpander) Update(ipmap *IntervalSet) error {
+	names := make(map[string]bool)
+	for _, owner := range e.owners {
+		names[owner.Name] = true
+	}
+
+	var union intervallist
+	for _, rec := range ipmap.btree {
+		if names[rec.Name] {
+			union = append(union, rec)
+		}
+	}
+	union = append(union, e.routes.btree...)
+	sort.SliceStable(union, func(i, j int) bool {
+		if union[i].Name != union[j].Name {
+			return union[i].Name < union[j].Name
+		}
+		return union[i].Left.Less(union[j].Left)
+	})
+
+	var merged intervallist
+	for _, rec := range union {
+		last := len(merged) - 1
+		if last < 0 || merged[last].Name != rec.Name || merged[last].Right.Less(rec.Left) {
+			merged = append(merged, rec)
+			continue
+		}
+		cur := &merged[last]
+		if !cur.Right.Less(rec.Right) {
+			// contained
+			continue
+		}
+		if tooLarge(cur.Left, rec.Right) {
+			// keep the rest separate
+			rec.Left = cur.Right.add1()
+			merged = append(merged, rec)
+			continue
+		}
+		cur.Right = rec.Right
+	}
+
+	for name := range names {
+		ipmap.DeleteByName(name)
+	}
+	for _, rec := range merged {
+		if err := ipmap.AddInterval(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package ipcat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// mrtRIB returns a TABLE_DUMP_V2 RIB record for a prefix with one
+// entry per AS path
+func mrtRIB(p netip.Prefix, addPath bool, paths ...[]uint32) []byte {
+	subtype := uint16(mrtRIBIPv4Unicast)
+	if p.Addr().Is6() {
+		subtype = mrtRIBIPv6Unicast
+	}
+	if addPath {
+		subtype += mrtRIBIPv4UnicastAddPath - mrtRIBIPv4Unicast
+	}
+	body := binary.BigEndian.AppendUint32(nil, 1)
+	body = append(body, byte(p.Bits()))
+	body = append(body, p.Addr().AsSlice()[:(p.Bits()+7)/8]...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(paths)))
+	for _, path := range paths {
+		// ORIGIN attribute, then AS_PATH as one AS_SEQUENCE
+		attrs := []byte{0x40, 1, 1, 0}
+		attrs = append(attrs, 0x50, bgpAttrASPath)
+		attrs = binary.BigEndian.AppendUint16(attrs, uint16(2+4*len(path)))
+		attrs = append(attrs, bgpASSequence, byte(len(path)))
+		for _, asn := range path {
+			attrs = binary.BigEndian.AppendUint32(attrs, asn)
+		}
+		body = binary.BigEndian.AppendUint16(body, 0)
+		body = binary.BigEndian.AppendUint32(body, 1700000000)
+		if addPath {
+			body = binary.BigEndian.AppendUint32(body, 7)
+		}
+		body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+		body = append(body, attrs...)
+	}
+	rec := binary.BigEndian.AppendUint32(nil, 1700000000)
+	rec = binary.BigEndian.AppendUint16(rec, mrtTableDumpV2)
+	rec = binary.BigEndian.AppendUint16(rec, subtype)
+	rec = binary.BigEndian.AppendUint32(rec, uint32(len(body)))
+	return append(rec, body...)
+}
+
+func TestASNExpander(t *testing.T) {
+	owners, err := ParseASNMap(strings.NewReader("# name,url,ASNs\nHetzner Online AG,https://www.hetzner.com/,AS24940,213230\n"))
+	if err != nil {
+		t.Fatalf("ParseASNMap error: %s", err)
+	}
+
+	var mrt bytes.Buffer
+	// a PEER_INDEX_TABLE record, skipped
+	mrt.Write([]byte{0x65, 0, 0, 0, 0, mrtTableDumpV2, 0, 1, 0, 0, 0, 2, 0xab, 0xcd})
+	mrt.Write(mrtRIB(netip.MustParsePrefix("5.9.0.0/16"), false, []uint32{3356, 24940}, []uint32{174, 24940}))
+	mrt.Write(mrtRIB(netip.MustParsePrefix("5.9.10.0/24"), false, []uint32{3356, 24940}))
+	mrt.Write(mrtRIB(netip.MustParsePrefix("5.10.0.0/16"), true, []uint32{3356, 213230}))
+	mrt.Write(mrtRIB(netip.MustParsePrefix("2a01:4f8::/32"), false, []uint32{6939, 24940}))
+	mrt.Write(mrtRIB(netip.MustParsePrefix("192.0.2.0/24"), false, []uint32{24940, 64496}))
+
+	e := NewASNExpander(owners)
+	if err := e.Read(&mrt); err != nil {
+		t.Fatalf("Read MRT error: %s", err)
+	}
+	table := "# prefix asn\n88.198.0.0/16 AS24940\n78.46.0.0 15 24940_64500\n198.51.100.0/24 64496\n"
+	if err := e.Read(strings.NewReader(table)); err != nil {
+		t.Fatalf("Read prefix table error: %s", err)
+	}
+
+	ipset := NewIntervalSet(10)
+	ipset.AddRange("5.9.0.0", "5.9.0.255", "Hetzner Online AG", "https://www.hetzner.com/")
+	ipset.AddCIDR("213.239.192.0/18", "Hetzner Online AG", "https://www.hetzner.com/")
+	ipset.AddCIDR("192.0.2.0/24", "Other", "")
+	if err := e.Update(ipset); err != nil {
+		t.Fatalf("Update error: %s", err)
+	}
+
+	want := []string{
+		"5.9.0.0/16",
+		"5.10.0.0/16",
+		"78.46.0.0/15",
+		"88.198.0.0/16",
+		"213.239.192.0/18",
+		"2a01:4f8::/32",
+	}
+	var got []string
+	for rec := range ipset.ByName("Hetzner Online AG") {
+		for _, p := range rec.Prefixes() {
+			got = append(got, p.String())
+		}
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Update ranges = %v, want %v", got, want)
+	}
+	rec, _ := ipset.Contains("192.0.2.1")
+	if rec == nil || rec.Name != "Other" {
+		t.Errorf("Contains(192.0.2.1) = %v, want Other", rec)
+	}
+
+	if err := NewASNExpander(owners).ReadMRT(bytes.NewReader(mrtRIB(netip.MustParsePrefix("5.9.0.0/16"), false, []uint32{1})[:20])); err == nil {
+		t.Errorf("ReadMRT accepted a truncated record")
+	}
+}
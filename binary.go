@@ -0,0 +1,235 @@
+package ipcat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"time"
+)
+
+// Binary format, all integers big-endian:
+//
+//	magic    "IPCB"
+//	version  uint16
+//	ncols    uint16  number of uint32 attribute columns per record
+//	nstrings uint32
+//	nrecords uint32
+//	strings  nstrings times: uvarint length, bytes
+//	lefts    nrecords times: 16 bytes
+//	rights   nrecords times: 16 bytes
+//	attrs    nrecords times: ncols uint32 values
+//	crc32    IEEE checksum of everything before it
+//
+// String attributes are stored as indexes into the string table, so
+// each distinct name or URL is stored and allocated once.  The last
+// seen time is stored as Unix seconds, 0 if unknown.  New columns
+// are only appended, so readers ignore columns they don't know about.
+const (
+	binaryMagic   = "IPCB"
+	binaryVersion = 1
+	binaryHeader  = 4 + 2 + 2 + 4 + 4
+)
+
+// binaryColumns is the number of attribute columns written
+const binaryColumns = 11
+
+// errBinaryFormat is returned for malformed binary data
+var errBinaryFormat = errors.New("ipcat: invalid binary data")
+
+// attrs returns the attribute columns of an interval, interning
+// strings with intern
+func (i *Interval) attrs(intern func(string) uint32) [binaryColumns]uint32 {
+	return [binaryColumns]uint32{
+		intern(i.Name),
+		intern(i.URL),
+		intern(string(i.Category)),
+		intern(i.Region),
+		intern(i.Service),
+		i.ASN,
+		intern(i.Source),
+		intern(i.Country),
+		intern(i.City),
+		intern(i.Postal),
+		uint32(max(i.LastSeen.Unix(), 0)),
+	}
+}
+
+// setAttrs is the inverse of attrs
+func (i *Interval) setAttrs(cols []uint32, strs []string) error {
+	str := func(idx uint32) (string, error) {
+		if int(idx) >= len(strs) {
+			return "", errBinaryFormat
+		}
+		return strs[idx], nil
+	}
+	var err error
+	for c, v := range cols {
+		switch c {
+		case 0:
+			i.Name, err = str(v)
+		case 1:
+			i.URL, err = str(v)
+		case 2:
+			var cat string
+			cat, err = str(v)
+			i.Category = Category(cat)
+		case 3:
+			i.Region, err = str(v)
+		case 4:
+			i.Service, err = str(v)
+		case 5:
+			i.ASN = v
+		case 6:
+			i.Source, err = str(v)
+		case 7:
+			i.Country, err = str(v)
+		case 8:
+			i.City, err = str(v)
+		case 9:
+			i.Postal, err = str(v)
+		case 10:
+			if v != 0 {
+				i.LastSeen = time.Unix(int64(v), 0).UTC()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalBinary satisfies the encoding.BinaryMarshaler interface.  The
+// set is sorted first.
+func (ipset *IntervalSet) MarshalBinary() ([]byte, error) {
+	if err := ipset.sort(); err != nil {
+		return nil, err
+	}
+
+	index := map[string]uint32{"": 0}
+	strs := []string{""}
+	intern := func(s string) uint32 {
+		idx, ok := index[s]
+		if !ok {
+			idx = uint32(len(strs))
+			index[s] = idx
+			strs = append(strs, s)
+		}
+		return idx
+	}
+	attrs := make([][binaryColumns]uint32, len(ipset.btree))
+	for i := range ipset.btree {
+		attrs[i] = ipset.btree[i].attrs(intern)
+	}
+
+	buf := make([]byte, binaryHeader, binaryHeader+len(ipset.btree)*(32+4*binaryColumns))
+	copy(buf, binaryMagic)
+	binary.BigEndian.PutUint16(buf[4:], binaryVersion)
+	binary.BigEndian.PutUint16(buf[6:], binaryColumns)
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(strs)))
+	binary.BigEndian.PutUint32(buf[12:], uint32(len(ipset.btree)))
+	for _, s := range strs {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	for _, val := range ipset.btree {
+		buf = binary.BigEndian.AppendUint64(buf, val.Left.Hi)
+		buf = binary.BigEndian.AppendUint64(buf, val.Left.Lo)
+	}
+	for _, val := range ipset.btree {
+		buf = binary.BigEndian.AppendUint64(buf, val.Right.Hi)
+		buf = binary.BigEndian.AppendUint64(buf, val.Right.Lo)
+	}
+	for _, cols := range attrs {
+		for _, v := range cols {
+			buf = binary.BigEndian.AppendUint32(buf, v)
+		}
+	}
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf)), nil
+}
+
+// UnmarshalBinary satisfies the encoding.BinaryUnmarshaler interface.
+// It replaces the contents of the set.  The data is not retained.
+func (ipset *IntervalSet) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryHeader+4 || string(data[:4]) != binaryMagic {
+		return errBinaryFormat
+	}
+	if v := binary.BigEndian.Uint16(data[4:]); v != binaryVersion {
+		return fmt.Errorf("ipcat: unsupported binary version %d", v)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return errors.New("ipcat: binary data checksum mismatch")
+	}
+	ncols := int(binary.BigEndian.Uint16(data[6:]))
+	nstrs := int(binary.BigEndian.Uint32(data[8:]))
+	nrecs := int(binary.BigEndian.Uint32(data[12:]))
+
+	pos := binaryHeader
+	if nstrs > len(body)-pos {
+		return errBinaryFormat
+	}
+	strs := make([]string, nstrs)
+	for i := range strs {
+		n, size := binary.Uvarint(body[pos:])
+		if size <= 0 || n > uint64(len(body)-pos-size) {
+			return errBinaryFormat
+		}
+		pos += size
+		strs[i] = string(body[pos : pos+int(n)])
+		pos += int(n)
+	}
+
+	recsize := 32 + 4*ncols
+	if nrecs > (len(body)-pos)/recsize || len(body)-pos != nrecs*recsize {
+		return errBinaryFormat
+	}
+	lefts := body[pos : pos+16*nrecs]
+	rights := body[pos+16*nrecs : pos+32*nrecs]
+	attrs := body[pos+32*nrecs:]
+
+	list := make(intervallist, nrecs)
+	cols := make([]uint32, min(ncols, binaryColumns))
+	for i := range list {
+		rec := &list[i]
+		rec.Left = Uint128{
+			Hi: binary.BigEndian.Uint64(lefts[16*i:]),
+			Lo: binary.BigEndian.Uint64(lefts[16*i+8:]),
+		}
+		rec.Right = Uint128{
+			Hi: binary.BigEndian.Uint64(rights[16*i:]),
+			Lo: binary.BigEndian.Uint64(rights[16*i+8:]),
+		}
+		if rec.Right.Less(rec.Left) || (i > 0 && !list[i-1].Right.Less(rec.Left)) {
+			return fmt.Errorf("ipcat: binary data not sorted at record %d", i)
+		}
+		for c := range cols {
+			cols[c] = binary.BigEndian.Uint32(attrs[4*(ncols*i+c):])
+		}
+		if err := rec.setAttrs(cols, strs); err != nil {
+			return err
+		}
+		rec.seq = i
+	}
+
+	ipset.btree = list
+	ipset.seq = nrecs
+	ipset.overlaps = nil
+	ipset.sorted = true
+	return nil
+}
+
+// ReadBinaryFile reads a file written with MarshalBinary
+func ReadBinaryFile(filename string) (*IntervalSet, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	ipset := &IntervalSet{}
+	if err := ipset.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return ipset, nil
+}
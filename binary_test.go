@@ -0,0 +1,82 @@
+package ipcat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	f, err := os.Open("datacenters.csv")
+	if err != nil {
+		t.Fatalf("Unable to open datacenters.csv: %s", err)
+	}
+	defer f.Close()
+	ipset := NewIntervalSet(4096)
+	if err := ipset.ImportCSV(f); err != nil {
+		t.Fatalf("ImportCSV error: %s", err)
+	}
+	ipset.AddCIDRMeta("2600:1f00::/24", "Amazon AWS", "http://www.amazon.com/aws/", Metadata{
+		Category: CategoryCloud,
+		Region:   "us-east-1",
+		Service:  "EC2",
+		ASN:      16509,
+		Source:   "aws",
+		Country:  "US",
+		City:     "Ashburn",
+		Postal:   "20147",
+		LastSeen: time.Date(2026, 10, 17, 17, 1, 58, 0, time.UTC),
+	})
+
+	data, err := ipset.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %s", err)
+	}
+	got := &IntervalSet{}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary error: %s", err)
+	}
+	if got.Len() != ipset.Len() {
+		t.Fatalf("UnmarshalBinary has %d records, want %d", got.Len(), ipset.Len())
+	}
+	for i := range ipset.btree {
+		want, have := ipset.btree[i], got.btree[i]
+		if want.Left != have.Left || want.Right != have.Right || want.Name != have.Name ||
+			want.URL != have.URL || want.Metadata != have.Metadata {
+			t.Fatalf("record %d = %v, want %v", i, have, want)
+		}
+	}
+
+	// single bit flip must be caught by the checksum
+	data[len(data)/2] ^= 1
+	if err := got.UnmarshalBinary(data); err == nil {
+		t.Errorf("UnmarshalBinary accepted corrupt data")
+	}
+	data[len(data)/2] ^= 1
+
+	filename := filepath.Join(t.TempDir(), "datacenters.bin")
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBinaryFile(filename)
+	if err != nil {
+		t.Fatalf("ReadBinaryFile error: %s", err)
+	}
+	rec, err := read.Contains("2600:1f00::1")
+	if err != nil || rec == nil || rec.Region != "us-east-1" {
+		t.Errorf("Contains(%q) = %v, %v, want us-east-1 record", "2600:1f00::1", rec, err)
+	}
+}
+
+func TestBinaryInvalid(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		[]byte("IPCB"),
+		[]byte("XXXX\x00\x01\x00\x07\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+	} {
+		if err := (&IntervalSet{}).UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary(%q) did not return an error", data)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var (
+	bunnyCDNDownload  = "https://bunnycdn.com/api/system/edgeserverlist"
+	bunnyCDNDownload6 = "https://bunnycdn.com/api/system/edgeserverlist/ipv6"
+)
+
+const (
+	bunnyCDNName = "BunnyCDN"
+	bunnyCDNURL  = "https://bunny.net/"
+)
+
+func init() {
+	Register("bunnycdn", BunnyCDNProvider{})
+}
+
+// BunnyCDNProvider is the Provider for the BunnyCDN edge servers
+type BunnyCDNProvider struct{}
+
+// Name satisfies the Provider interface
+func (BunnyCDNProvider) Name() string { return bunnyCDNName }
+
+// URL satisfies the Provider interface
+func (BunnyCDNProvider) URL() string { return bunnyCDNURL }
+
+// Fetch satisfies the Provider interface
+func (BunnyCDNProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	v4, err := downloadBunnyCDN(ctx, f, bunnyCDNDownload)
+	if err != nil {
+		return nil, err
+	}
+	v6, err := downloadBunnyCDN(ctx, f, bunnyCDNDownload6)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(append(v4, v6...))
+}
+
+// Update satisfies the Provider interface
+func (BunnyCDNProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateBunnyCDN(ipmap, body)
+}
+
+func downloadBunnyCDN(ctx context.Context, f *Fetcher, url string) ([]string, error) {
+	// the default is XML
+	body, err := f.GetHeader(ctx, url, http.Header{"Accept": {"application/json"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// DownloadBunnyCDN downloads the latest BunnyCDN IPv4 and IPv6 edge
+// server lists, returned as one JSON array
+func DownloadBunnyCDN() ([]byte, error) {
+	return BunnyCDNProvider{}.Fetch(context.Background(), nil)
+}
+
+// UpdateBunnyCDN parses a JSON array of BunnyCDN edge server addresses
+// or ranges and updates the interval set
+func UpdateBunnyCDN(ipmap *IntervalSet, body []byte) error {
+	var list []string
+	err := json.Unmarshal(body, &list)
+	if err != nil {
+		return err
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(bunnyCDNName)
+
+	// and add back
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return fmt.Errorf("Unable to parse %s", s)
+			}
+			s = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+		err = ipmap.AddCIDRMeta(s, bunnyCDNName, bunnyCDNURL, Metadata{
+			Category: CategoryCDN,
+			Source:   "bunnycdn",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
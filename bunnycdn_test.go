@@ -0,0 +1,63 @@
+package ipcat
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBunnyCDN(t *testing.T) {
+	mux := http.NewServeMux()
+	serve := func(list string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept") != "application/json" {
+				fmt.Fprint(w, "<ArrayOfstring/>")
+				return
+			}
+			fmt.Fprint(w, list)
+		}
+	}
+	mux.HandleFunc("/edgeserverlist", serve(`["89.187.188.227","89.187.188.228"]`))
+	mux.HandleFunc("/edgeserverlist/ipv6", serve(`["2400:52e0:1a00::871:1"]`))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	setHook(t, &bunnyCDNDownload, ts.URL+"/edgeserverlist")
+	setHook(t, &bunnyCDNDownload6, ts.URL+"/edgeserverlist/ipv6")
+
+	b, err := DownloadBunnyCDN()
+	if err != nil {
+		t.Fatalf("DownloadBunnyCDN() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	err = UpdateBunnyCDN(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateBunnyCDN error: %v", err)
+	}
+	// adjacent addresses are merged
+	if _, err := ipset.Resolve(); err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	if n := ipset.Len(); n != 2 {
+		t.Errorf("UpdateBunnyCDN added %d records, want 2", n)
+	}
+	for _, tt := range []struct {
+		ip   string
+		want bool
+	}{
+		{"89.187.188.227", true},
+		{"89.187.188.228", true},
+		{"89.187.188.229", false},
+		{"2400:52e0:1a00::871:1", true},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if (rec != nil) != tt.want {
+			t.Errorf("ipset.Contains(%q) = %v, want exists %v", tt.ip, rec, tt.want)
+		} else if rec != nil && rec.Category != CategoryCDN {
+			t.Errorf("ipset.Contains(%q) category = %q, want %q", tt.ip, rec.Category, CategoryCDN)
+		}
+	}
+}
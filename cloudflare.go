@@ -2,46 +2,143 @@ package ipcat
 
 import (
 	"bytes"
-	"fmt"
-	"io/ioutil"
-	"net/http"
+	"context"
+	"encoding/json"
+	"errors"
 )
 
 var (
-	cloudflareDownload = "https://www.cloudflare.com/ips-v4"
+	cloudflareDownload    = "https://www.cloudflare.com/ips-v4"
+	cloudflareDownload6   = "https://www.cloudflare.com/ips-v6"
+	cloudflareDownloadAPI = "https://api.cloudflare.com/client/v4/ips"
 )
 
-// DownloadCloudflare downloads the latest Cloudflare IP ranges list
-func DownloadCloudflare() ([]byte, error) {
-	resp, err := http.Get(cloudflareDownload)
+const (
+	cloudflareName = "Cloudflare Inc"
+	cloudflareURL  = "https://www.cloudflare.com/"
+)
+
+func init() {
+	Register("cloudflare", CloudflareProvider{})
+}
+
+// CloudflareProvider is the Provider for Cloudflare
+type CloudflareProvider struct {
+	// UseAPI fetches the JSON API endpoint instead of the text lists
+	UseAPI bool
+}
+
+// Name satisfies the Provider interface
+func (CloudflareProvider) Name() string { return cloudflareName }
+
+// URL satisfies the Provider interface
+func (CloudflareProvider) URL() string { return cloudflareURL }
+
+// Fetch satisfies the Provider interface
+func (p CloudflareProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	if p.UseAPI {
+		return downloadCloudflare(ctx, f, cloudflareDownloadAPI)
+	}
+	v4, err := downloadCloudflare(ctx, f, cloudflareDownload)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Failed to download Cloudflare ranges: status code %s", resp.Status)
-	}
-	body, err := ioutil.ReadAll(resp.Body)
+	v6, err := downloadCloudflare(ctx, f, cloudflareDownload6)
 	if err != nil {
 		return nil, err
 	}
-	resp.Body.Close()
+	return append(append(v4, '\n'), v6...), nil
+}
+
+// Update satisfies the Provider interface
+func (CloudflareProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateCloudflare(ipmap, body)
+}
+
+// CloudflareIPs is the result of the Cloudflare IP API
+type CloudflareIPs struct {
+	IPv4CIDRs []string `json:"ipv4_cidrs"`
+	IPv6CIDRs []string `json:"ipv6_cidrs"`
+}
+
+// CloudflareAPIResponse is the envelope of the Cloudflare IP API
+type CloudflareAPIResponse struct {
+	Result  CloudflareIPs `json:"result"`
+	Success bool          `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
 
+func downloadCloudflare(ctx context.Context, f *Fetcher, url string) ([]byte, error) {
+	body, err := f.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
 	return bytes.TrimSpace(body), nil
 }
 
-// UpdateCloudflare parses the Cloudflare IP text file and updates the interval set
+// DownloadCloudflare downloads the latest Cloudflare IPv4 and IPv6
+// ranges lists, one range per line
+func DownloadCloudflare() ([]byte, error) {
+	return CloudflareProvider{}.Fetch(context.Background(), nil)
+}
+
+// DownloadCloudflareAPI downloads the latest Cloudflare ranges from
+// the JSON API
+func DownloadCloudflareAPI() ([]byte, error) {
+	return CloudflareProvider{UseAPI: true}.Fetch(context.Background(), nil)
+}
+
+// ParseCloudflareAPI parses a response of the Cloudflare IP API
+func ParseCloudflareAPI(body []byte) (CloudflareIPs, error) {
+	resp := CloudflareAPIResponse{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return CloudflareIPs{}, err
+	}
+	if !resp.Success {
+		msg := "unknown error"
+		if len(resp.Errors) > 0 {
+			msg = resp.Errors[0].Message
+		}
+		return CloudflareIPs{}, errors.New("Cloudflare API error: " + msg)
+	}
+	return resp.Result, nil
+}
+
+// UpdateCloudflare parses either the Cloudflare IP text lists or the
+// JSON API response and updates the interval set.  In the text lists
+// blank lines and lines starting with # are ignored.  Ranges are
+// tagged as CDN proxies.
 func UpdateCloudflare(ipmap *IntervalSet, body []byte) error {
-	const (
-		cloudflareName = "Cloudflare Inc"
-		cloudflareURL  = "https://www.cloudflare.com/"
-	)
+	var cidrs []string
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '{' {
+		ips, err := ParseCloudflareAPI(b)
+		if err != nil {
+			return err
+		}
+		cidrs = append(ips.IPv4CIDRs, ips.IPv6CIDRs...)
+	} else {
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 || line[0] == '#' {
+				continue
+			}
+			cidrs = append(cidrs, string(line))
+		}
+	}
 
 	// delete all existing records
 	ipmap.DeleteByName(cloudflareName)
 
 	// and add back
-	for _, cidr := range bytes.Split(body, []byte("\n")) {
-		err := ipmap.AddCIDR(string(cidr), cloudflareName, cloudflareURL)
+	for _, cidr := range cidrs {
+		err := ipmap.AddCIDRMeta(cidr, cloudflareName, cloudflareURL, Metadata{
+			Category: CategoryCDN,
+			Service:  "proxy",
+			Source:   "cloudflare",
+		})
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,73 @@
+package ipcat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCloudflare(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ips-v4", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "173.245.48.0/20\n103.21.244.0/22\n")
+	})
+	mux.HandleFunc("/ips-v6", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "2400:cb00::/32\n\n")
+	})
+	mux.HandleFunc("/client/v4/ips", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"result": {
+				"ipv4_cidrs": ["173.245.48.0/20"],
+				"ipv6_cidrs": ["2606:4700::/32"],
+				"etag": "38f79d050aa027e3be3865e495dcc9bc"
+			},
+			"success": true,
+			"errors": [],
+			"messages": []
+		}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	setHook(t, &cloudflareDownload, ts.URL+"/ips-v4")
+	setHook(t, &cloudflareDownload6, ts.URL+"/ips-v6")
+	setHook(t, &cloudflareDownloadAPI, ts.URL+"/client/v4/ips")
+
+	for _, tt := range []struct {
+		p    CloudflareProvider
+		want []string
+	}{
+		{CloudflareProvider{}, []string{"173.245.48.1", "103.21.244.1", "2400:cb00::1"}},
+		{CloudflareProvider{UseAPI: true}, []string{"173.245.48.1", "2606:4700::1"}},
+	} {
+		body, err := tt.p.Fetch(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("Fetch() error: %v", err)
+		}
+		ipset := NewIntervalSet(10)
+		if err := tt.p.Update(ipset, body); err != nil {
+			t.Fatalf("Update error: %v", err)
+		}
+		if ipset.Len() != len(tt.want) {
+			t.Errorf("Update added %d records, want %d", ipset.Len(), len(tt.want))
+		}
+		for _, ip := range tt.want {
+			rec, err := ipset.Contains(ip)
+			if err != nil {
+				t.Fatalf("ipset.Contains(%q) error: %v", ip, err)
+			}
+			if rec == nil || rec.Category != CategoryCDN {
+				t.Errorf("ipset.Contains(%q) = %v, want CDN record", ip, rec)
+			}
+		}
+	}
+
+	ips, err := ParseCloudflareAPI([]byte(`{"result":{"ipv4_cidrs":["173.245.48.0/20"]},"success":true}`))
+	if err != nil || len(ips.IPv4CIDRs) != 1 {
+		t.Errorf("ParseCloudflareAPI() = %v, %v, want one IPv4 range", ips, err)
+	}
+	if _, err := ParseCloudflareAPI([]byte(`{"success":false,"errors":[{"code":1,"message":"nope"}]}`)); err == nil {
+		t.Errorf("ParseCloudflareAPI() did not return an error for an unsuccessful response")
+	}
+}
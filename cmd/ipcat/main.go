@@ -1,31 +1,95 @@
 package main
 
 import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/client9/ipcat"
 )
 
 func main() {
 	lookup := flag.String("l", "", "lookup an IP address")
-	updateAWS := flag.Bool("aws", false, "update AWS records")
-	updateAzure := flag.Bool("azure", false, "update Azure records")
-	updateAppEngine := flag.Bool("appengine", false, "update AppEngine (Google App Engine) records")
-	updateCloudflare := flag.Bool("cloudflare", false, "update Cloudflare records")
+	list := flag.String("list", "", "print the CIDR ranges of a provider")
+	update := flag.String("update", "", "update records from providers, comma separated or \"all\": "+
+		strings.Join(ipcat.ProviderKeys(), ", ")+".  \"all\" leaves out the short-lived providers, kept in layers.csv or relay.csv: "+
+		strings.Join(ipcat.LayerKeys(), ", "))
 	datafile := flag.String("csvfile", "datacenters.csv", "read/write from this file")
+	layerfile := flag.String("layerfile", "layers.csv", "short-lived ranges, such as Tor exits, checked before -csvfile by -l")
 	statsfile := flag.String("statsfile", "datacenters-stats.csv", "write statistics to this file")
+	extended := flag.Bool("extended", false, "write the data file with metadata columns")
+	jsonfile := flag.String("jsonfile", "", "also write records with metadata to this JSON file")
+	binfile := flag.String("binfile", "", "also write records in the binary format to this file")
+	mmdbfile := flag.String("mmdbfile", "", "also write records as a MaxMind DB to this file")
+	mmdbEpoch := flag.Int64("mmdbepoch", 0, "build time of -mmdbfile in Unix seconds, 0 for now")
+	importMMDB := flag.String("importmmdb", "", "add the records of this MaxMind DB file")
+	mmdbName := flag.String("mmdbname", "name", "record field holding the provider name for -importmmdb")
+	importGeofeed := flag.String("importgeofeed", "", "add the records of a RFC 8805 geofeed file or URL [name,url,feed]")
+	geofeedfile := flag.String("geofeedfile", "", "also write records as a RFC 8805 geofeed to this file")
+	geofeedName := flag.String("geofeedname", "", "only write the records of this provider to -geofeedfile")
+	rir := flag.String("rir", "", "propose candidate ranges from RIR bulk files, comma separated RPSL dumps or delegated-*-extended files, optionally gzipped")
+	rirRules := flag.String("rirrules", "", "rules for -rir, one per line [name,url,keyword or ASN,...]")
+	rirfile := flag.String("rirfile", "rir-candidates.csv", "write the -rir candidates for review to this file")
+	rib := flag.String("rib", "", "add the prefixes originated by the -asnmap ASNs from these comma separated MRT RIB dumps or prefix tables, optionally gzip or bzip2 compressed")
+	asnMap := flag.String("asnmap", "", "ASN to provider mapping for -rib, one provider per line [name,url,ASN,...]")
+	merge := flag.String("merge", "", "add the records of this classic or extended CSV file, such as reviewed -rir candidates")
 	addCIDR := flag.String("addcidr", "", "add this CIDR range to the data file [CIDR,name,url]")
+	timeout := flag.Duration("timeout", ipcat.DefaultFetchTimeout, "time limit for each download attempt")
+	retries := flag.Int("retries", ipcat.DefaultFetchRetries, "retries after failed downloads, 0 for none")
+	record := flag.String("record", "", "save every download to this directory, for use with -replay")
+	replay := flag.String("replay", "", "answer downloads from a -record directory instead of the network")
+	overlap := flag.String("overlap", "reject", "how to resolve overlapping ranges: reject, most-specific, first-source or priority")
+	priority := map[string]int{}
+	flag.Func("priority", "source or name priority for -overlap priority, and for equal ranges with most-specific [name=N], may be repeated", func(val string) error {
+		i := strings.LastIndex(val, "=")
+		if i == -1 {
+			return fmt.Errorf("priority must be in format: name=N")
+		}
+		n, err := strconv.Atoi(val[i+1:])
+		if err != nil {
+			return err
+		}
+		priority[val[:i]] = n
+		return nil
+	})
 	flag.Parse()
 
+	fetcher := &ipcat.Fetcher{Timeout: *timeout, Retries: *retries}
+	if *retries == 0 {
+		fetcher.Retries = -1
+	}
+	switch {
+	case *record != "" && *replay != "":
+		log.Fatal("-record and -replay can not be used together")
+	case *record != "":
+		fetcher.Mode, fetcher.Fixtures = ipcat.FetchRecord, *record
+	case *replay != "":
+		fetcher.Mode, fetcher.Fixtures = ipcat.FetchReplay, *replay
+	}
+	ipcat.DefaultFetcher = fetcher
+
+	policy, err := ipcat.ParseOverlapPolicy(*overlap)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	filein, err := os.Open(*datafile)
 	if err != nil {
 		log.Fatalf("Unable to read %s: %s", *datafile, err)
 	}
 	set := ipcat.IntervalSet{}
+	set.SetOverlapPolicy(policy)
+	set.SetSourcePriority(priority)
 	err = set.ImportCSV(filein)
 	if err != nil {
 		log.Fatalf("Unable to import: %s", err)
@@ -34,58 +98,115 @@ func main() {
 	log.Printf("Loaded %d entries", set.Len())
 
 	if *lookup != "" {
-		rec, err := set.Contains(*lookup)
+		rec, err := lookupLayer(*layerfile, *lookup)
+		if err == nil && rec == nil {
+			rec, err = set.Contains(*lookup)
+		}
 		if err != nil {
 			log.Fatalf("Unable to find %s: %s", *lookup, err)
 		}
 		if rec == nil {
 			log.Fatalf("Not found: %s", *lookup)
 		}
-		fmt.Printf("[%s:%s] %s %s\n", rec.LeftDots, rec.RightDots, rec.Name, rec.URL)
+		fmt.Printf("[%s:%s] %s %s", rec.LeftDots(), rec.RightDots(), rec.Name, rec.URL)
+		for _, attr := range []string{string(rec.Category), rec.Service, rec.Region, rec.City, rec.Country} {
+			if attr != "" {
+				fmt.Printf(", %s", attr)
+			}
+		}
+		if !rec.LastSeen.IsZero() {
+			fmt.Printf(", last seen %s", rec.LastSeen.Format(time.RFC3339))
+		}
+		fmt.Println()
 		return
 	}
 
-	if *updateAWS {
-		body, err := ipcat.DownloadAWS()
+	if *list != "" {
+		recs, err := set.RangesByName(*list)
 		if err != nil {
-			log.Fatalf("Unable to download AWS rules: %s", err)
+			log.Fatal(err)
+		}
+		for _, rec := range recs {
+			for _, p := range rec.Prefixes() {
+				fmt.Println(p)
+			}
 		}
-		err = ipcat.UpdateAWS(&set, body)
+		return
+	}
+
+	if *rir != "" {
+		candidates, err := scanRIR(&set, *rir, *rirRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fileout, err := os.OpenFile(*rirfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			log.Fatalf("Unable to open file to write: %s", err)
+		}
+		err = candidates.ExportCSVExtended(fileout)
+		if err != nil {
+			log.Fatalf("Unable to export candidates: %s", err)
+		}
+		fileout.Close()
+		log.Printf("Wrote %d candidates to %s", candidates.Len(), *rirfile)
+		return
+	}
+
+	if *update != "" {
+		list, err := ipcat.ParseProviderList(*update)
 		if err != nil {
-			log.Fatalf("Unable to parse AWS rules: %s", err)
+			log.Fatal(err)
+		}
+		for _, p := range list {
+			err = ipcat.UpdateProvider(context.Background(), fetcher, &set, p)
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
 
-	if *updateAzure {
-		body, err := ipcat.DownloadAzure()
+	if *importMMDB != "" {
+		data, err := os.ReadFile(*importMMDB)
+		if err != nil {
+			log.Fatalf("Unable to read %s: %s", *importMMDB, err)
+		}
+		err = set.ImportMMDB(data, *mmdbName)
 		if err != nil {
-			log.Fatalf("Unable to download Azure rules: %s", err)
+			log.Fatalf("Unable to import %s: %s", *importMMDB, err)
 		}
-		err = ipcat.UpdateAzure(&set, body)
+	}
+
+	if *rib != "" {
+		err := expandASNs(&set, *rib, *asnMap)
 		if err != nil {
-			log.Fatalf("Unable to parse Azure rules: %s", err)
+			log.Fatal(err)
 		}
 	}
 
-	if *updateAppEngine {
-		body, err := ipcat.DownloadAppEngine()
+	if *merge != "" {
+		filein, err := os.Open(*merge)
 		if err != nil {
-			log.Fatalf("Unable to download AppEngine rules: %s", err)
+			log.Fatalf("Unable to read %s: %s", *merge, err)
 		}
-		err = ipcat.UpdateAppEngine(&set, body)
+		err = set.MergeCSV(filein)
+		filein.Close()
 		if err != nil {
-			log.Fatalf("Unable to parse AppEngine rules: %s", err)
+			log.Fatalf("Unable to merge %s: %s", *merge, err)
 		}
 	}
 
-	if *updateCloudflare {
-		body, err := ipcat.DownloadCloudflare()
+	if *importGeofeed != "" {
+		t := strings.SplitN(*importGeofeed, ",", 3)
+		if len(t) != 3 {
+			log.Fatal("geofeed must be in format: name,url,feed")
+		}
+		body, err := ipcat.ReadGeofeed(t[2])
 		if err != nil {
-			log.Fatalf("Unable to download Cloudflare IP ranges: %s", err)
+			log.Fatalf("Unable to read %s: %s", t[2], err)
 		}
-		err = ipcat.UpdateCloudflare(&set, body)
+		err = set.ImportGeofeed(bytes.NewReader(body), t[0], t[1])
 		if err != nil {
-			log.Fatalf("Unable to parse Cloudflare IP ranges: %s", err)
+			log.Fatalf("Unable to import %s: %s", t[2], err)
 		}
 	}
 
@@ -101,19 +222,78 @@ func main() {
 		log.Println("Range added successfully")
 	}
 
+	overlaps, err := set.Resolve()
+	if err != nil {
+		log.Fatalf("Unable to resolve overlaps: %s", err)
+	}
+	for _, o := range overlaps {
+		log.Printf("Overlap: %s", o)
+	}
+
 	if *statsfile != "" {
 		fileout, err := os.OpenFile(*statsfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 		if err != nil {
 			log.Fatalf("Unable to open file to write: %s", err)
 		}
 		list := set.RankBySize()
-		fileout.WriteString("Datacenter Name, Total IPs\n")
+		fileout.WriteString("Datacenter Name, Total IPs, Total IPv6 /64s\n")
 		for _, val := range list {
 			name := val.Name
 			if strings.Contains(name, ",") {
 				name = fmt.Sprintf("%q", val.Name)
 			}
-			fileout.WriteString(fmt.Sprintf("%s,%d\n", name, val.Size))
+			fileout.WriteString(fmt.Sprintf("%s,%d,%d\n", name, val.Size, val.Size6))
+		}
+		fileout.Close()
+	}
+
+	if *jsonfile != "" {
+		fileout, err := os.OpenFile(*jsonfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			log.Fatalf("Unable to open file to write: %s", err)
+		}
+		err = set.ExportJSON(fileout)
+		if err != nil {
+			log.Fatalf("Unable to export JSON: %s", err)
+		}
+		fileout.Close()
+	}
+
+	if *binfile != "" {
+		data, err := set.MarshalBinary()
+		if err != nil {
+			log.Fatalf("Unable to export binary: %s", err)
+		}
+		err = os.WriteFile(*binfile, data, 0644)
+		if err != nil {
+			log.Fatalf("Unable to write %s: %s", *binfile, err)
+		}
+	}
+
+	if *mmdbfile != "" {
+		fileout, err := os.OpenFile(*mmdbfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			log.Fatalf("Unable to open file to write: %s", err)
+		}
+		built := time.Now()
+		if *mmdbEpoch != 0 {
+			built = time.Unix(*mmdbEpoch, 0)
+		}
+		err = set.ExportMMDB(fileout, built)
+		if err != nil {
+			log.Fatalf("Unable to export MaxMind DB: %s", err)
+		}
+		fileout.Close()
+	}
+
+	if *geofeedfile != "" {
+		fileout, err := os.OpenFile(*geofeedfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			log.Fatalf("Unable to open file to write: %s", err)
+		}
+		err = set.ExportGeofeed(fileout, *geofeedName)
+		if err != nil {
+			log.Fatalf("Unable to export geofeed: %s", err)
 		}
 		fileout.Close()
 	}
@@ -122,9 +302,125 @@ func main() {
 	if err != nil {
 		log.Fatalf("Unable to open file to write: %s", err)
 	}
-	err = set.ExportCSV(fileout)
+	if *extended {
+		err = set.ExportCSVExtended(fileout)
+	} else {
+		err = set.ExportCSV(fileout)
+	}
 	if err != nil {
 		log.Fatalf("Unable to export: %s", err)
 	}
 	fileout.Close()
 }
+
+// lookupLayer looks up an address in the layer file, if there is one
+func lookupLayer(filename, ip string) (*ipcat.Interval, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	filein, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer filein.Close()
+	layers := ipcat.NewIntervalSet(100)
+	if err := layers.ImportCSV(filein); err != nil {
+		return nil, fmt.Errorf("Unable to import %s: %s", filename, err)
+	}
+	return layers.Contains(ip)
+}
+
+// scanRIR reads RIR bulk files and returns the candidate ranges not
+// yet in the set
+func scanRIR(set *ipcat.IntervalSet, files, rulesfile string) (*ipcat.IntervalSet, error) {
+	if rulesfile == "" {
+		return nil, fmt.Errorf("-rir needs -rirrules")
+	}
+	f, err := os.Open(rulesfile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %s", rulesfile, err)
+	}
+	rules, err := ipcat.ParseRIRRules(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %s", rulesfile, err)
+	}
+
+	scanner := ipcat.NewRIRScanner(rules)
+	for _, filename := range strings.Split(files, ",") {
+		in, f, err := openData(filename)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(filepath.Base(filename), "delegated-") {
+			err = scanner.ReadDelegated(in)
+		} else {
+			err = scanner.ReadRPSL(in)
+		}
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s", filename, err)
+		}
+	}
+	if scanner.Skipped > 0 {
+		log.Printf("Skipped %d matching records that were invalid or too large", scanner.Skipped)
+	}
+	return scanner.Candidates(set)
+}
+
+// expandASNs adds the prefixes originated by mapped ASNs in RIB files
+// to the set
+func expandASNs(set *ipcat.IntervalSet, files, mapfile string) error {
+	if mapfile == "" {
+		return fmt.Errorf("-rib needs -asnmap")
+	}
+	f, err := os.Open(mapfile)
+	if err != nil {
+		return fmt.Errorf("Unable to read %s: %s", mapfile, err)
+	}
+	owners, err := ipcat.ParseASNMap(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Unable to parse %s: %s", mapfile, err)
+	}
+
+	expander := ipcat.NewASNExpander(owners)
+	for _, filename := range strings.Split(files, ",") {
+		in, f, err := openData(filename)
+		if err != nil {
+			return err
+		}
+		err = expander.Read(in)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("Unable to parse %s: %s", filename, err)
+		}
+	}
+	if expander.Skipped > 0 {
+		log.Printf("Skipped %d prefixes that were too large", expander.Skipped)
+	}
+	return expander.Update(set)
+}
+
+// openData opens a data file, decompressing .gz and .bz2 files
+func openData(filename string) (io.Reader, io.Closer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read %s: %s", filename, err)
+	}
+	switch {
+	case strings.HasSuffix(filename, ".gz"):
+		in, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("Unable to read %s: %s", filename, err)
+		}
+		return in, f, nil
+	case strings.HasSuffix(filename, ".bz2"):
+		return bzip2.NewReader(f), f, nil
+	}
+	return f, f, nil
+}
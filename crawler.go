@@ -0,0 +1,172 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+var (
+	googlebotDownload              = "https://developers.google.com/static/search/apis/ipranges/googlebot.json"
+	googleSpecialCrawlersDownload  = "https://developers.google.com/static/search/apis/ipranges/special-crawlers.json"
+	googleUserFetchersDownload     = "https://developers.google.com/static/search/apis/ipranges/user-triggered-fetchers.json"
+	googleUserFetchersGoogDownload = "https://developers.google.com/static/search/apis/ipranges/user-triggered-fetchers-google.json"
+	bingbotDownload                = "https://www.bing.com/toolbox/bingbot.json"
+	applebotDownload               = "https://search.developer.apple.com/applebot.json"
+)
+
+func init() {
+	RegisterLayer("googlebot", CrawlerProvider{
+		ProviderName: "Googlebot",
+		ProviderURL:  "https://developers.google.com/search/docs/crawling-indexing/verifying-googlebot",
+		Source:       "googlebot",
+		Lists: []CrawlerList{
+			{"googlebot", googlebotDownload},
+			{"special-crawlers", googleSpecialCrawlersDownload},
+			{"user-triggered-fetchers", googleUserFetchersDownload},
+			{"user-triggered-fetchers-google", googleUserFetchersGoogDownload},
+		},
+	})
+	RegisterLayer("bingbot", CrawlerProvider{
+		ProviderName: "Bingbot",
+		ProviderURL:  "https://www.bing.com/webmasters/help/which-crawlers-does-bing-use-8c184ec0",
+		Source:       "bingbot",
+		Lists:        []CrawlerList{{"bingbot", bingbotDownload}},
+	})
+	RegisterLayer("applebot", CrawlerProvider{
+		ProviderName: "Applebot",
+		ProviderURL:  "https://support.apple.com/en-us/119829",
+		Source:       "applebot",
+		Lists:        []CrawlerList{{"applebot", applebotDownload}},
+	})
+}
+
+// CrawlerList is a published list of crawler ranges, in the format of
+// Google's googlebot.json
+type CrawlerList struct {
+	// Service is recorded as the service of the list's ranges
+	Service string
+
+	// Download is the URL of the list
+	Download string
+}
+
+// CrawlerProvider is a Provider for verified search engine crawlers.
+// Its records have the category CategoryCrawler, so a crawler can be
+// told apart from the cloud or hosting ranges of the same company.
+type CrawlerProvider struct {
+	ProviderName string
+	ProviderURL  string
+	Source       string
+	Lists        []CrawlerList
+}
+
+// Name satisfies the Provider interface
+func (p CrawlerProvider) Name() string { return p.ProviderName }
+
+// URL satisfies the Provider interface
+func (p CrawlerProvider) URL() string { return p.ProviderURL }
+
+// Fetch satisfies the Provider interface.  The lists are returned as
+// one JSON object keyed by service.
+func (p CrawlerProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	lists := make(map[string]json.RawMessage, len(p.Lists))
+	for _, l := range p.Lists {
+		body, err := f.Get(ctx, l.Download)
+		if err != nil {
+			return nil, err
+		}
+		lists[l.Service] = body
+	}
+	return json.Marshal(lists)
+}
+
+// Update satisfies the Provider interface.  Either a single list or
+// the lists keyed by service, as returned by Fetch, are accepted.  A
+// single list is recorded with the service of the first list, and a
+// range in several lists with the service of the first of them in
+// Lists.
+func (p CrawlerProvider) Update(ipmap *IntervalSet, body []byte) error {
+	services := make([]string, 0, len(p.Lists))
+	for _, l := range p.Lists {
+		services = append(services, l.Service)
+	}
+	service := ""
+	if len(services) > 0 {
+		service = services[0]
+	}
+	return updateCrawler(ipmap, body, p.ProviderName, p.ProviderURL, p.Source, service, services)
+}
+
+// DownloadCrawlerList downloads a crawler list
+func DownloadCrawlerList(url string) ([]byte, error) {
+	return DefaultFetcher.Get(context.Background(), url)
+}
+
+// UpdateCrawler parses crawler lists, either a single list or an object
+// of lists keyed by service, and replaces the records named name.  A
+// single list is recorded with the given service, and a range in
+// several lists with the service that sorts first.
+func UpdateCrawler(ipmap *IntervalSet, body []byte, name, url, source, service string) error {
+	return updateCrawler(ipmap, body, name, url, source, service, nil)
+}
+
+// updateCrawler is UpdateCrawler with the services of a range in
+// several lists in order of precedence.  Services not in order follow
+// in sorted order.
+func updateCrawler(ipmap *IntervalSet, body []byte, name, url, source, service string, order []string) error {
+	lists := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &lists)
+	if err != nil {
+		return err
+	}
+	if _, ok := lists["prefixes"]; ok {
+		lists = map[string]json.RawMessage{service: body}
+	}
+	var services []string
+	for _, s := range order {
+		if _, ok := lists[s]; ok && !slices.Contains(services, s) {
+			services = append(services, s)
+		}
+	}
+	for _, s := range slices.Sorted(maps.Keys(lists)) {
+		if !slices.Contains(services, s) {
+			services = append(services, s)
+		}
+	}
+
+	tmp := NewIntervalSet(100)
+	seen := make(map[string]bool)
+	for _, s := range services {
+		ranges := GoogleRanges{}
+		if err := json.Unmarshal(lists[s], &ranges); err != nil {
+			return fmt.Errorf("Unable to parse %s ranges: %s", s, err)
+		}
+		for _, rec := range ranges.Prefixes {
+			cidr := rec.IPv4Prefix
+			if cidr == "" {
+				cidr = rec.IPv6Prefix
+			}
+			if seen[cidr] {
+				continue
+			}
+			seen[cidr] = true
+			err := tmp.AddCIDRMeta(cidr, name, url, Metadata{
+				Category: CategoryCrawler,
+				Service:  s,
+				Source:   source,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(name)
+
+	// and add back
+	return addResolved(ipmap, tmp)
+}
@@ -0,0 +1,89 @@
+package ipcat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrawler(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+
+	p := CrawlerProvider{
+		ProviderName: "Bingbot",
+		ProviderURL:  "https://www.bing.com/",
+		Source:       "bingbot",
+		Lists: []CrawlerList{
+			{"bingbot", ts.URL + "/bingbot.json"},
+			{"applebot", ts.URL + "/applebot.json"},
+		},
+	}
+	b, err := p.Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	ipset.AddCIDRMeta("40.77.0.0/16", "Microsoft Azure", "", Metadata{Category: CategoryCloud})
+	ipset.SetOverlapPolicy(OverlapMostSpecific)
+	if err := p.Update(ipset, b); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		ip       string
+		category Category
+		service  string
+	}{
+		{"40.77.167.1", CategoryCrawler, "bingbot"},
+		{"40.77.168.1", CategoryCloud, ""},
+		{"157.55.39.1", CategoryCrawler, "bingbot"},
+		{"2a01:b747:3000:200::1", CategoryCrawler, "applebot"},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Category != tt.category || rec.Service != tt.service {
+			t.Errorf("ipset.Contains(%q) = %q %q, want %q %q", tt.ip, rec.Category, rec.Service, tt.category, tt.service)
+		}
+	}
+
+	// a single list takes the service of the first list
+	single := NewIntervalSet(10)
+	if err := p.Update(single, mustReadFile(t, "testdata/applebot.json")); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	rec, _ := single.Contains("17.241.208.1")
+	if rec == nil || rec.Service != "bingbot" {
+		t.Errorf("single list Contains(17.241.208.1) = %v, want service bingbot", rec)
+	}
+
+	// a range in two lists takes the service listed first, or with
+	// UpdateCrawler the one that sorts first
+	shared := []byte(`{
+		"bingbot": {"prefixes": [{"ipv4Prefix": "157.55.39.0/24"}]},
+		"applebot": {"prefixes": [{"ipv4Prefix": "157.55.39.0/24"}]}
+	}`)
+	for _, tt := range []struct {
+		update func(*IntervalSet) error
+		want   string
+	}{
+		{func(s *IntervalSet) error { return p.Update(s, shared) }, "bingbot"},
+		{func(s *IntervalSet) error { return UpdateCrawler(s, shared, "Bingbot", "", "bingbot", "bingbot") }, "applebot"},
+	} {
+		set := NewIntervalSet(10)
+		if err := tt.update(set); err != nil {
+			t.Fatalf("Update error: %v", err)
+		}
+		rec, _ := set.Contains("157.55.39.1")
+		if rec == nil || rec.Service != tt.want {
+			t.Errorf("shared range Contains(157.55.39.1) = %v, want service %s", rec, tt.want)
+		}
+	}
+}
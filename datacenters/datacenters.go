@@ -0,0 +1,86 @@
+// Package datacenters embeds the ipcat datacenters.csv dataset so IP
+// addresses can be classified with a single import and no data file
+// to deploy.  The short-lived ranges of layers.csv, such as Tor exits
+// and VPN servers, are embedded too and take precedence over the
+// datacenter ranges they are inside of.  The datasets are parsed once,
+// on first use.
+package datacenters
+
+import (
+	"bytes"
+	_ "embed" // for go:embed
+	"net/netip"
+	"sync"
+
+	"github.com/client9/ipcat"
+)
+
+//go:generate cp ../datacenters.csv datacenters.csv
+//go:generate cp ../layers.csv layers.csv
+
+//go:embed datacenters.csv
+var csvData []byte
+
+//go:embed layers.csv
+var layersData []byte
+
+func parse(data []byte) (*ipcat.Snapshot, error) {
+	set := ipcat.NewIntervalSet(4096)
+	if err := set.ImportCSV(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return set.Snapshot()
+}
+
+var load = sync.OnceValues(func() (*ipcat.Snapshot, error) {
+	return parse(csvData)
+})
+
+var loadLayers = sync.OnceValues(func() (*ipcat.Snapshot, error) {
+	return parse(layersData)
+})
+
+// Load returns the parsed datacenters.csv dataset.  It is safe for
+// concurrent use.
+func Load() (*ipcat.Snapshot, error) {
+	return load()
+}
+
+// LoadLayers returns the parsed layers.csv dataset.  It is safe for
+// concurrent use.
+func LoadLayers() (*ipcat.Snapshot, error) {
+	return loadLayers()
+}
+
+func mustLoad(load func() (*ipcat.Snapshot, error)) *ipcat.Snapshot {
+	snap, err := load()
+	if err != nil {
+		panic("datacenters: embedded dataset is invalid: " + err.Error())
+	}
+	return snap
+}
+
+// Lookup returns the record for an IP address in text form, and false
+// if it is not a datacenter address or not a valid address
+func Lookup(ip string) (ipcat.Interval, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ipcat.Interval{}, false
+	}
+	return LookupAddr(addr)
+}
+
+// LookupAddr returns the record for an address, and false if it is
+// not a datacenter address.  Records of layers.csv are returned before
+// those of datacenters.csv.
+func LookupAddr(addr netip.Addr) (ipcat.Interval, bool) {
+	return lookupAddr(mustLoad(loadLayers), mustLoad(load), addr)
+}
+
+// lookupAddr returns the record of the first snapshot holding addr
+func lookupAddr(layers, base *ipcat.Snapshot, addr netip.Addr) (ipcat.Interval, bool) {
+	if rec, ok := layers.LookupAddr(addr); ok {
+		return rec, true
+	}
+	return base.LookupAddr(addr)
+}
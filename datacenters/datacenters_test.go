@@ -0,0 +1,66 @@
+package datacenters
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/client9/ipcat"
+)
+
+func TestEmbeddedUpToDate(t *testing.T) {
+	for file, data := range map[string][]byte{"datacenters.csv": csvData, "layers.csv": layersData} {
+		upstream, err := os.ReadFile("../" + file)
+		if err != nil {
+			t.Fatalf("Unable to read ../%s: %s", file, err)
+		}
+		if !bytes.Equal(upstream, data) {
+			t.Errorf("embedded %s is stale, run go generate ./datacenters", file)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	snap, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error: %s", err)
+	}
+	if snap.Len() == 0 {
+		t.Fatalf("Load() returned an empty dataset")
+	}
+	rec, ok := Lookup("3.0.0.1")
+	if !ok || rec.Name != "Amazon AWS" {
+		t.Errorf("Lookup(%q) = %v, %v, want Amazon AWS", "3.0.0.1", rec, ok)
+	}
+	if _, ok := Lookup("127.0.0.1"); ok {
+		t.Errorf("Lookup(%q) found a datacenter", "127.0.0.1")
+	}
+	if _, ok := Lookup("busted"); ok {
+		t.Errorf("Lookup(%q) found a datacenter", "busted")
+	}
+}
+
+func TestLookupLayers(t *testing.T) {
+	base := ipcat.NewIntervalSet(10)
+	base.AddCIDR("10.0.0.0/24", "Hoster", "")
+	layers := ipcat.NewIntervalSet(10)
+	layers.AddCIDRMeta("10.0.0.5/32", "Tor Exit Node", "", ipcat.Metadata{Category: ipcat.CategoryTorExit})
+	baseSnap, err := base.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerSnap, err := layers.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]string{"10.0.0.5": "Tor Exit Node", "10.0.0.9": "Hoster"} {
+		rec, ok := lookupAddr(layerSnap, baseSnap, netip.MustParseAddr(ip))
+		if !ok || rec.Name != want {
+			t.Errorf("lookupAddr(%s) = %q, %v, want %q", ip, rec.Name, ok, want)
+		}
+	}
+	if _, err := LoadLayers(); err != nil {
+		t.Errorf("LoadLayers() error: %s", err)
+	}
+}
@@ -0,0 +1,74 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+)
+
+var (
+	fastlyDownload = "https://api.fastly.com/public-ip-list"
+)
+
+const (
+	fastlyName = "Fastly"
+	fastlyURL  = "https://www.fastly.com/"
+)
+
+func init() {
+	Register("fastly", FastlyProvider{})
+}
+
+// FastlyProvider is the Provider for the Fastly CDN
+type FastlyProvider struct{}
+
+// Name satisfies the Provider interface
+func (FastlyProvider) Name() string { return fastlyName }
+
+// URL satisfies the Provider interface
+func (FastlyProvider) URL() string { return fastlyURL }
+
+// Fetch satisfies the Provider interface
+func (FastlyProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, fastlyDownload)
+}
+
+// Update satisfies the Provider interface
+func (FastlyProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateFastly(ipmap, body)
+}
+
+// FastlyPublicIPList is the Fastly public IP list
+type FastlyPublicIPList struct {
+	Addresses     []string `json:"addresses"`
+	IPv6Addresses []string `json:"ipv6_addresses"`
+}
+
+// DownloadFastly downloads the latest Fastly public IP list
+func DownloadFastly() ([]byte, error) {
+	return FastlyProvider{}.Fetch(context.Background(), nil)
+}
+
+// UpdateFastly parses the Fastly public IP list and updates the
+// interval set
+func UpdateFastly(ipmap *IntervalSet, body []byte) error {
+	list := FastlyPublicIPList{}
+	err := json.Unmarshal(body, &list)
+	if err != nil {
+		return err
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(fastlyName)
+
+	// and add back
+	for _, cidr := range append(list.Addresses, list.IPv6Addresses...) {
+		err = ipmap.AddCIDRMeta(cidr, fastlyName, fastlyURL, Metadata{
+			Category: CategoryCDN,
+			Source:   "fastly",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
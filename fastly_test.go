@@ -0,0 +1,36 @@
+package ipcat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFastly(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	setHook(t, &fastlyDownload, ts.URL+"/fastly.json")
+
+	b, err := DownloadFastly()
+	if err != nil {
+		t.Fatalf("DownloadFastly() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	ipset.AddCIDR("151.101.0.0/16", fastlyName, fastlyURL)
+	err = UpdateFastly(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateFastly error: %v", err)
+	}
+	if n := ipset.Len(); n != 8 {
+		t.Errorf("UpdateFastly added %d records, want 8", n)
+	}
+	for _, ip := range []string{"151.101.1.1", "199.232.1.1", "2a04:4e42::1"} {
+		rec, err := ipset.Contains(ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", ip, err)
+		}
+		if rec == nil || rec.Name != fastlyName || rec.Category != CategoryCDN {
+			t.Errorf("ipset.Contains(%q) = %v, want %s CDN record", ip, rec, fastlyName)
+		}
+	}
+}
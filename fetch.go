@@ -0,0 +1,207 @@
+package ipcat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Fetcher defaults, used for zero fields
+const (
+	DefaultFetchTimeout = 60 * time.Second
+	DefaultFetchRetries = 2
+	DefaultFetchBackoff = time.Second
+	DefaultFetchMaxSize = 256 << 20
+	DefaultUserAgent    = "ipcat (+https://github.com/client9/ipcat)"
+)
+
+// FetchMode selects between live downloads and fixtures
+type FetchMode int
+
+// Fetch modes
+const (
+	// FetchLive downloads every request
+	FetchLive FetchMode = iota
+
+	// FetchRecord downloads every request and stores the response
+	// body in the fixture directory
+	FetchRecord
+
+	// FetchReplay answers every request from the fixture directory,
+	// without using the network
+	FetchReplay
+)
+
+// Fetcher downloads provider data over HTTP.  The zero value is ready
+// to use with the defaults, and a nil *Fetcher uses DefaultFetcher.
+type Fetcher struct {
+	// Client is the HTTP client.  Nil means a client using Transport.
+	Client *http.Client
+
+	// Transport is used when Client is nil.  Nil means
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// Timeout limits each attempt, 0 means DefaultFetchTimeout
+	Timeout time.Duration
+
+	// Retries is the number of retries after network errors and
+	// 429 or 5xx responses.  0 means DefaultFetchRetries, negative
+	// means none.
+	Retries int
+
+	// Backoff is the wait before the first retry, doubled for each
+	// further retry.  0 means DefaultFetchBackoff.
+	Backoff time.Duration
+
+	// MaxSize limits the size of a response body, 0 means
+	// DefaultFetchMaxSize
+	MaxSize int64
+
+	// UserAgent is sent with every request, "" means
+	// DefaultUserAgent
+	UserAgent string
+
+	// Mode and Fixtures enable recording responses to, or replaying
+	// them from, the directory Fixtures
+	Mode     FetchMode
+	Fixtures string
+}
+
+// DefaultFetcher is used by the Download functions and when no
+// Fetcher is given
+var DefaultFetcher = &Fetcher{}
+
+// Get downloads url and returns the response body.  Any status other
+// than 200 is an error.
+func (f *Fetcher) Get(ctx context.Context, url string) ([]byte, error) {
+	return f.GetHeader(ctx, url, nil)
+}
+
+// GetHeader is Get sending extra request headers
+func (f *Fetcher) GetHeader(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	if f == nil {
+		f = DefaultFetcher
+	}
+	switch f.Mode {
+	case FetchReplay:
+		body, err := os.ReadFile(f.fixture(url))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("No fixture for %s in %s", url, f.Fixtures)
+		}
+		return body, err
+	case FetchRecord:
+		body, err := f.get(ctx, url, header)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(f.Fixtures, 0755); err != nil {
+			return nil, err
+		}
+		return body, os.WriteFile(f.fixture(url), body, 0644)
+	}
+	return f.get(ctx, url, header)
+}
+
+// get downloads url, retrying with backoff
+func (f *Fetcher) get(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	retries := f.Retries
+	if retries == 0 {
+		retries = DefaultFetchRetries
+	}
+	backoff := f.Backoff
+	if backoff == 0 {
+		backoff = DefaultFetchBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		body, retry, err := f.attempt(ctx, url, header)
+		if err == nil || !retry || attempt >= retries {
+			return body, err
+		}
+		t := time.NewTimer(backoff << attempt)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// attempt makes a single request, and reports if a failure is worth
+// retrying
+func (f *Fetcher) attempt(ctx context.Context, url string, header http.Header) ([]byte, bool, error) {
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = DefaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	agent := f.UserAgent
+	if agent == "" {
+		agent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", agent)
+
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Transport: f.Transport}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// retry network errors, but not a cancelled caller
+		return nil, ctx.Err() == nil || errors.Is(ctx.Err(), context.DeadlineExceeded), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("Failed to download %s: status code %s", url, resp.Status)
+	}
+
+	max := f.MaxSize
+	if max == 0 {
+		max = DefaultFetchMaxSize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, true, err
+	}
+	if int64(len(body)) > max {
+		return nil, false, fmt.Errorf("Response from %s is larger than %d bytes", url, max)
+	}
+	return body, false, nil
+}
+
+// fixture returns the fixture file for a URL, named after the URL
+// without its scheme
+func (f *Fetcher) fixture(url string) string {
+	_, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		rest = url
+	}
+	name := []byte(rest)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-') {
+			name[i] = '_'
+		}
+	}
+	if len(name) > 200 {
+		name = fmt.Appendf(name[:191], "_%08x", crc32.ChecksumIEEE([]byte(url)))
+	}
+	return filepath.Join(f.Fixtures, string(name))
+}
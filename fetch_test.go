@@ -0,0 +1,128 @@
+package ipcat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetcherRetry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		case "/missing":
+			calls.Add(1)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	f := &Fetcher{Backoff: time.Millisecond}
+	body, err := f.Get(context.Background(), ts.URL+"/flaky")
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if string(body) != "ok" || calls.Load() != 3 {
+		t.Errorf("Get() = %q after %d calls, want \"ok\" after 3", body, calls.Load())
+	}
+
+	calls.Store(0)
+	_, err = f.Get(context.Background(), ts.URL+"/missing")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Get() of a missing page returned %v, want a 404 error", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Get() of a missing page made %d calls, want 1", calls.Load())
+	}
+
+	calls.Store(0)
+	f.Retries = -1
+	if _, err := f.Get(context.Background(), ts.URL+"/flaky"); err == nil {
+		t.Errorf("Get() without retries did not return an error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Get() without retries made %d calls, want 1", calls.Load())
+	}
+}
+
+func TestFetcherRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.UserAgent() + " " + r.Header.Get("Accept")))
+	}))
+	defer ts.Close()
+
+	body, err := (*Fetcher)(nil).Get(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if got := strings.TrimSpace(string(body)); got != DefaultUserAgent {
+		t.Errorf("Get() sent User-Agent %q, want %q", got, DefaultUserAgent)
+	}
+
+	f := &Fetcher{UserAgent: "test"}
+	body, err = f.GetHeader(context.Background(), ts.URL, http.Header{"Accept": {"application/json"}})
+	if err != nil {
+		t.Fatalf("GetHeader() error: %v", err)
+	}
+	if string(body) != "test application/json" {
+		t.Errorf("GetHeader() sent %q, want \"test application/json\"", body)
+	}
+
+	f = &Fetcher{MaxSize: 4}
+	if _, err := f.Get(context.Background(), ts.URL); err == nil {
+		t.Errorf("Get() of a response over MaxSize did not return an error")
+	}
+}
+
+func TestFetcherCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	f := &Fetcher{Backoff: time.Hour}
+	start := time.Now()
+	if _, err := f.Get(ctx, ts.URL); err != context.DeadlineExceeded {
+		t.Errorf("Get() with an expiring context returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Get() waited for the backoff after the context expired")
+	}
+}
+
+func TestFetcherRecordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	dir := t.TempDir()
+	setHook(t, &awsDownload, ts.URL+"/aws.json")
+
+	rec := &Fetcher{Mode: FetchRecord, Fixtures: dir}
+	want, err := AWSProvider{}.Fetch(context.Background(), rec)
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	ts.Close()
+
+	replay := &Fetcher{Mode: FetchReplay, Fixtures: dir}
+	got, err := AWSProvider{}.Fetch(context.Background(), replay)
+	if err != nil {
+		t.Fatalf("Fetch() in replay mode error: %v", err)
+	}
+	if len(got) == 0 || string(got) != string(want) {
+		t.Errorf("Fetch() in replay mode returned a different body")
+	}
+	if _, err := replay.Get(context.Background(), ts.URL+"/other.json"); err == nil {
+		t.Errorf("Get() in replay mode without a fixture did not return an error")
+	}
+}
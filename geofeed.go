@@ -0,0 +1,260 @@
+package ipcat
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// RFC 8805 geofeeds, see https://www.rfc-editor.org/rfc/rfc8805
+//
+// A geofeed is a CSV file with the columns prefix, country (ISO 3166-1
+// alpha-2), region (ISO 3166-2), city and postal code.  Only the
+// prefix is required.  Lines starting with # are comments.
+
+var (
+	digitalOceanDownload = "https://digitalocean.com/geo/google.csv"
+	linodeDownload       = "https://geoip.linode.com/"
+	vultrDownload        = "https://geofeed.constant.com/?text"
+	icloudRelayDownload  = "https://mask-api.icloud.com/egress-ip-ranges.csv"
+)
+
+func init() {
+	Register("digitalocean", GeofeedProvider{
+		ProviderName: "DigitalOcean",
+		ProviderURL:  "https://www.digitalocean.com/",
+		Download:     digitalOceanDownload,
+		Source:       "digitalocean",
+		Category:     CategoryHosting,
+		Replaces: []string{
+			"DigitalOcean England",
+			"DigitalOcean Europe",
+			"DigitalOcean Great Britain",
+			"DigitalOcean Netherlands",
+			"DigitalOcean Singapore",
+			"DigitalOcean USA",
+		},
+	})
+	Register("linode", GeofeedProvider{
+		ProviderName: "Linode",
+		ProviderURL:  "http://www.linode.com/",
+		Download:     linodeDownload,
+		Source:       "linode",
+		Category:     CategoryHosting,
+		Replaces:     []string{"Linode Japan"},
+	})
+	Register("vultr", GeofeedProvider{
+		ProviderName: "Vultr",
+		ProviderURL:  "https://www.vultr.com/",
+		Download:     vultrDownload,
+		Source:       "vultr",
+		Category:     CategoryHosting,
+		// Choopa is the former name of Vultr's parent company
+		Replaces: []string{"Choopa"},
+	})
+	RegisterLayer("icloudrelay", GeofeedProvider{
+		ProviderName: "iCloud Private Relay",
+		ProviderURL:  "https://support.apple.com/en-us/102602",
+		Download:     icloudRelayDownload,
+		Source:       "icloudrelay",
+		Category:     CategoryRelay,
+	})
+}
+
+// GeofeedEntry is a row of an RFC 8805 geofeed
+type GeofeedEntry struct {
+	Prefix  netip.Prefix
+	Country string
+	Region  string
+	City    string
+	Postal  string
+}
+
+// ParseGeofeed parses an RFC 8805 geofeed.  Blank lines and comments
+// are skipped, missing trailing columns are empty.
+func ParseGeofeed(in io.Reader) ([]GeofeedEntry, error) {
+	r := csv.NewReader(in)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	var out []GeofeedEntry
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		prefix, err := netip.ParsePrefix(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid geofeed prefix %q on line %d", record[0], line)
+		}
+		for len(record) < 5 {
+			record = append(record, "")
+		}
+		out = append(out, GeofeedEntry{
+			Prefix:  prefix.Masked(),
+			Country: strings.ToUpper(record[1]),
+			Region:  strings.ToUpper(record[2]),
+			City:    record[3],
+			Postal:  record[4],
+		})
+	}
+	return out, nil
+}
+
+// DownloadGeofeed downloads a geofeed
+func DownloadGeofeed(url string) ([]byte, error) {
+	return DefaultFetcher.Get(context.Background(), url)
+}
+
+// UpdateGeofeed parses a geofeed and replaces the records named name
+// with its prefixes.  The country, region, city and postal code of
+// each prefix are added to meta.
+func UpdateGeofeed(ipmap *IntervalSet, body []byte, name, url string, meta Metadata) error {
+	return updateGeofeed(ipmap, body, name, url, meta, nil)
+}
+
+// updateGeofeed is UpdateGeofeed also deleting the records with the
+// replaced names
+func updateGeofeed(ipmap *IntervalSet, body []byte, name, url string, meta Metadata, replaces []string) error {
+	entries, err := ParseGeofeed(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	tmp := NewIntervalSet(len(entries))
+	for _, e := range entries {
+		m := meta
+		m.Country = e.Country
+		m.Region = e.Region
+		m.City = e.City
+		m.Postal = e.Postal
+		if err := tmp.AddPrefixMeta(e.Prefix, name, url, m); err != nil {
+			return err
+		}
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(name)
+	for _, old := range replaces {
+		ipmap.DeleteByName(old)
+	}
+
+	// and add back
+	return addResolved(ipmap, tmp)
+}
+
+// GeofeedProvider is a Provider for a company publishing its ranges
+// as an RFC 8805 geofeed
+type GeofeedProvider struct {
+	ProviderName string
+	ProviderURL  string
+
+	// Download is the URL of the geofeed
+	Download string
+
+	// Source and Category are recorded in the metadata
+	Source   string
+	Category Category
+
+	// Replaces lists older record names covered by the feed, which
+	// are deleted on update
+	Replaces []string
+}
+
+// Name satisfies the Provider interface
+func (p GeofeedProvider) Name() string { return p.ProviderName }
+
+// URL satisfies the Provider interface
+func (p GeofeedProvider) URL() string { return p.ProviderURL }
+
+// Fetch satisfies the Provider interface
+func (p GeofeedProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, p.Download)
+}
+
+// Update satisfies the Provider interface
+func (p GeofeedProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return updateGeofeed(ipmap, body, p.ProviderName, p.ProviderURL, Metadata{
+		Category: p.Category,
+		Source:   p.Source,
+	}, p.Replaces)
+}
+
+// ReadGeofeed reads a geofeed from a http or https URL, or else from
+// a file
+func ReadGeofeed(location string) ([]byte, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return DownloadGeofeed(location)
+	}
+	return os.ReadFile(location)
+}
+
+// ImportGeofeed imports an RFC 8805 geofeed, replacing the records
+// named name with its prefixes
+func (ipset *IntervalSet) ImportGeofeed(in io.Reader, name, url string) error {
+	body, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	return UpdateGeofeed(ipset, body, name, url, Metadata{Source: "geofeed"})
+}
+
+// isSubdivision reports if region is an ISO 3166-2 code, such as
+// "US-WA", of the country
+func isSubdivision(region, country string) bool {
+	code, ok := strings.CutPrefix(region, country+"-")
+	if country == "" || !ok || len(code) == 0 || len(code) > 3 {
+		return false
+	}
+	for _, c := range code {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportGeofeed exports the records named name, or all records if name
+// is empty, as an RFC 8805 geofeed.  Names are matched as in ByName.
+// Ranges are split into prefixes.  A region is only written if it is
+// an ISO 3166-2 code of the country, so cloud regions such as
+// "us-east-1" are left out.
+func (ipset *IntervalSet) ExportGeofeed(out io.Writer, name string) error {
+	if err := ipset.sort(); err != nil {
+		return err
+	}
+	want := ipset.canonicalName(name)
+	w := csv.NewWriter(out)
+	for _, val := range ipset.btree {
+		if name != "" && ipset.canonicalName(val.Name) != want {
+			continue
+		}
+		region := val.Region
+		if !isSubdivision(region, val.Country) {
+			region = ""
+		}
+		for _, p := range val.Prefixes() {
+			err := w.Write([]string{p.String(), val.Country, region, val.City, val.Postal})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,122 @@
+package ipcat
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseGeofeed(t *testing.T) {
+	feed := `# prefix,country,region,city,postal
+192.0.2.0/24,US,US-WA,Seattle,98101
+
+198.51.100.7/24, nl , nl-nh ,Amsterdam
+2001:db8::/32
+`
+	entries, err := ParseGeofeed(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("ParseGeofeed error: %s", err)
+	}
+	want := []GeofeedEntry{
+		{netip.MustParsePrefix("192.0.2.0/24"), "US", "US-WA", "Seattle", "98101"},
+		{netip.MustParsePrefix("198.51.100.0/24"), "NL", "NL-NH", "Amsterdam", ""},
+		{netip.MustParsePrefix("2001:db8::/32"), "", "", "", ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("ParseGeofeed returned %d entries, want %d", len(entries), len(want))
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	if _, err := ParseGeofeed(strings.NewReader("192.0.2.0/24,US\nnot-a-prefix,US\n")); err == nil {
+		t.Errorf("ParseGeofeed accepted an invalid prefix")
+	}
+}
+
+func TestGeofeedProvider(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+
+	p, _ := LookupProvider("digitalocean")
+	do := p.(GeofeedProvider)
+	do.Download = ts.URL + "/digitalocean.csv"
+
+	b, err := do.Fetch(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	ipset.AddCIDR("5.101.96.0/21", "DigitalOcean Netherlands", "https://www.digitalocean.com/")
+	if err := do.Update(ipset, b); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	if recs, _ := ipset.RangesByName("DigitalOcean Netherlands"); len(recs) != 0 {
+		t.Errorf("Update kept %d replaced records", len(recs))
+	}
+
+	for _, tt := range []struct {
+		ip      string
+		country string
+		region  string
+		city    string
+	}{
+		{"5.101.96.1", "NL", "NL-NH", "Amsterdam"},
+		{"128.199.130.1", "SG", "SG-01", "Singapore"},
+		{"2a03:b0c0:3::1", "DE", "DE-HE", "Frankfurt"},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Name != "DigitalOcean" || rec.Category != CategoryHosting || rec.Country != tt.country ||
+			rec.Region != tt.region || rec.City != tt.city {
+			t.Errorf("ipset.Contains(%q) = %+v, want DigitalOcean %s %s %s", tt.ip, rec, tt.country, tt.region, tt.city)
+		}
+	}
+}
+
+func TestGeofeedRoundTrip(t *testing.T) {
+	feed := `192.0.2.0/24,US,US-WA,Seattle,98101
+198.51.100.0/25,NL,NL-NH,Amsterdam,
+2001:db8::/32,DE,,,
+`
+	ipset := NewIntervalSet(10)
+	ipset.AddCIDRMeta("203.0.113.0/24", "Other", "", Metadata{Region: "us-east-1", Country: "US"})
+	if err := ipset.ImportGeofeed(strings.NewReader(feed), "Example", "https://example.com/"); err != nil {
+		t.Fatalf("ImportGeofeed error: %s", err)
+	}
+	rec, err := ipset.Contains("192.0.2.1")
+	if err != nil || rec == nil {
+		t.Fatalf("Contains(192.0.2.1) = %v, %v", rec, err)
+	}
+	if rec.Name != "Example" || rec.City != "Seattle" || rec.Postal != "98101" {
+		t.Errorf("Contains(192.0.2.1) = %+v, want Example in Seattle 98101", rec)
+	}
+
+	var buf bytes.Buffer
+	if err := ipset.ExportGeofeed(&buf, "example"); err != nil {
+		t.Fatalf("ExportGeofeed error: %s", err)
+	}
+	if buf.String() != feed {
+		t.Errorf("ExportGeofeed() = %q, want %q", buf.String(), feed)
+	}
+
+	buf.Reset()
+	if err := ipset.ExportGeofeed(&buf, ""); err != nil {
+		t.Fatalf("ExportGeofeed error: %s", err)
+	}
+	if want := "203.0.113.0/24,US,,,\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("ExportGeofeed() = %q, want it to contain %q", buf.String(), want)
+	}
+}
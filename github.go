@@ -0,0 +1,116 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+var (
+	githubDownload = "https://api.github.com/meta"
+)
+
+const (
+	githubName = "GitHub"
+	githubURL  = "https://github.com/"
+)
+
+// githubServices are the range lists of the GitHub meta API.  A prefix
+// listed under several services is tagged with the first of them, so
+// the Actions runners are never hidden behind a broader service.
+var githubServices = []string{
+	"actions",
+	"actions_macos",
+	"codespaces",
+	"copilot",
+	"dependabot",
+	"hooks",
+	"pages",
+	"packages",
+	"importer",
+	"github_enterprise_importer",
+	"git",
+	"api",
+	"web",
+}
+
+func init() {
+	Register("github", GitHubProvider{})
+}
+
+// GitHubProvider is the Provider for GitHub
+type GitHubProvider struct{}
+
+// Name satisfies the Provider interface
+func (GitHubProvider) Name() string { return githubName }
+
+// URL satisfies the Provider interface
+func (GitHubProvider) URL() string { return githubURL }
+
+// Fetch satisfies the Provider interface
+func (GitHubProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, githubDownload)
+}
+
+// Update satisfies the Provider interface
+func (GitHubProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateGitHub(ipmap, body)
+}
+
+// DownloadGitHub downloads the latest GitHub meta API document
+func DownloadGitHub() ([]byte, error) {
+	return GitHubProvider{}.Fetch(context.Background(), nil)
+}
+
+// UpdateGitHub parses the GitHub meta API document, IPv4 and IPv6,
+// and updates the interval set.  Each prefix is tagged with its
+// service, such as "actions" or "hooks".
+func UpdateGitHub(ipmap *IntervalSet, body []byte) error {
+	meta := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &meta)
+	if err != nil {
+		return err
+	}
+
+	service := make(map[string]string)
+	var order []string
+	for _, s := range githubServices {
+		raw, ok := meta[s]
+		if !ok {
+			continue
+		}
+		var cidrs []string
+		if err := json.Unmarshal(raw, &cidrs); err != nil {
+			return fmt.Errorf("Unable to parse GitHub %s ranges: %s", s, err)
+		}
+		for _, cidr := range cidrs {
+			if _, ok := service[cidr]; !ok {
+				service[cidr] = s
+				order = append(order, cidr)
+			}
+		}
+	}
+
+	tmp := NewIntervalSet(len(order))
+	for _, cidr := range order {
+		category := CategoryHosting
+		switch service[cidr] {
+		case "actions", "actions_macos", "codespaces":
+			category = CategoryCloud
+		}
+		err := tmp.AddCIDRMeta(cidr, githubName, githubURL, Metadata{
+			Category: category,
+			Service:  service[cidr],
+			Source:   "github",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(githubName)
+
+	// and add back
+	return addResolved(ipmap, tmp)
+}
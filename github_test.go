@@ -0,0 +1,53 @@
+package ipcat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitHub(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	setHook(t, &githubDownload, ts.URL+"/github.json")
+
+	b, err := DownloadGitHub()
+	if err != nil {
+		t.Fatalf("DownloadGitHub() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	err = UpdateGitHub(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateGitHub error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		ip       string
+		service  string
+		category Category
+	}{
+		{"140.82.112.1", "hooks", CategoryHosting},
+		{"140.82.113.35", "copilot", CategoryHosting},
+		{"140.82.121.33", "packages", CategoryHosting},
+		{"185.199.109.153", "pages", CategoryHosting},
+		{"20.201.28.148", "api", CategoryHosting},
+		{"4.148.1.1", "actions", CategoryCloud},
+		{"13.105.49.1", "actions_macos", CategoryCloud},
+		{"2606:50c0:8000::153", "pages", CategoryHosting},
+		{"2a0a:a440::1", "hooks", CategoryHosting},
+		{"2603:1030:8:5::9", "actions", CategoryCloud},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Name != githubName || rec.Service != tt.service || rec.Category != tt.category {
+			t.Errorf("ipset.Contains(%q) = %q %q %q, want %q %q %q", tt.ip,
+				rec.Name, rec.Service, rec.Category, githubName, tt.service, tt.category)
+		}
+	}
+}
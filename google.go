@@ -0,0 +1,95 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+)
+
+var (
+	googleCloudDownload = "https://www.gstatic.com/ipranges/cloud.json"
+)
+
+const (
+	googleCloudName = "Google Cloud"
+	googleCloudURL  = "https://cloud.google.com/"
+)
+
+func init() {
+	Register("google", GoogleCloudProvider{})
+}
+
+// GoogleCloudProvider is the Provider for Google Cloud, including
+// App Engine
+type GoogleCloudProvider struct{}
+
+// Name satisfies the Provider interface
+func (GoogleCloudProvider) Name() string { return googleCloudName }
+
+// URL satisfies the Provider interface
+func (GoogleCloudProvider) URL() string { return googleCloudURL }
+
+// Fetch satisfies the Provider interface
+func (GoogleCloudProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, googleCloudDownload)
+}
+
+// Update satisfies the Provider interface
+func (GoogleCloudProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateGoogleCloud(ipmap, body)
+}
+
+// GooglePrefix is a prefix in Google's published IP ranges files.
+// Exactly one of IPv4Prefix and IPv6Prefix is set.
+type GooglePrefix struct {
+	IPv4Prefix string `json:"ipv4Prefix"`
+	IPv6Prefix string `json:"ipv6Prefix"`
+	Service    string `json:"service"`
+	Scope      string `json:"scope"`
+}
+
+// GoogleRanges is the main record of Google's published IP ranges
+// files such as cloud.json
+type GoogleRanges struct {
+	SyncToken    string         `json:"syncToken"`
+	CreationTime string         `json:"creationTime"`
+	Prefixes     []GooglePrefix `json:"prefixes"`
+}
+
+// DownloadGoogleCloud downloads the latest Google Cloud cloud.json
+func DownloadGoogleCloud() ([]byte, error) {
+	return GoogleCloudProvider{}.Fetch(context.Background(), nil)
+}
+
+// UpdateGoogleCloud parses the Google Cloud cloud.json file and updates
+// the interval set.  The scope of each prefix is recorded as its region.
+// Records from the older App Engine SPF lookup are replaced as well.
+func UpdateGoogleCloud(ipmap *IntervalSet, body []byte) error {
+	ranges := GoogleRanges{}
+	err := json.Unmarshal(body, &ranges)
+	if err != nil {
+		return err
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(googleCloudName)
+	ipmap.DeleteByName(appEngineName)
+
+	// and add back
+	for _, rec := range ranges.Prefixes {
+		cidr := rec.IPv4Prefix
+		if cidr == "" {
+			cidr = rec.IPv6Prefix
+		}
+		err := ipmap.AddCIDRMeta(cidr, googleCloudName, googleCloudURL, Metadata{
+			Category: CategoryCloud,
+			Region:   rec.Scope,
+			Service:  rec.Service,
+			Source:   "google",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
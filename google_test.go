@@ -0,0 +1,48 @@
+package ipcat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoogleCloud(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	setHook(t, &googleCloudDownload, ts.URL+"/google.json")
+
+	b, err := DownloadGoogleCloud()
+	if err != nil {
+		t.Fatalf("DownloadGoogleCloud() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	ipset.AddCIDR("8.34.208.0/20", appEngineName, appEngineURL)
+	err = UpdateGoogleCloud(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateGoogleCloud error: %v", err)
+	}
+	if recs, _ := ipset.RangesByName(appEngineName); len(recs) != 0 {
+		t.Errorf("UpdateGoogleCloud kept %d App Engine records", len(recs))
+	}
+
+	for _, tt := range []struct {
+		ip     string
+		region string
+	}{
+		{"34.35.1.1", "africa-south1"},
+		{"2600:1900:8000::1", "africa-south1"},
+		{"8.34.208.1", "us-central1"},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Name != googleCloudName || rec.Region != tt.region {
+			t.Errorf("ipset.Contains(%q) = %q %q, want %q %q", tt.ip, rec.Name, rec.Region, googleCloudName, tt.region)
+		}
+	}
+}
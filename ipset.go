@@ -5,24 +5,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
 	"sort"
 	"strings"
 )
 
-// generic utility function
-//    returns 0 if not valid
-func dots2uint32(dots string) uint32 {
-	ip := net.ParseIP(dots)
-	if ip == nil {
-		return 0
-	}
-	ip = ip.To4()
-	if ip == nil {
-		return 0
-	}
-	return uint32(ip[0])<<24 + uint32(ip[1])<<16 + uint32(ip[2])<<8 + uint32(ip[3])
-}
-
 // CIDR2Range converts a CIDR to a dotted IP address pair, or empty strings and error
 //
 // Generic.. does not care if ipv4 or ipv6
@@ -31,17 +18,14 @@ func CIDR2Range(c string) (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
-	left4 := left.To4()
-	if left4 == nil {
-		return "", "", nil
+	if len(ipnet.Mask) == net.IPv4len {
+		left = left.To4()
 	}
-	right := net.IPv4(0, 0, 0, 0).To4()
-	right[0] = left4[0] | ^ipnet.Mask[0]
-	right[1] = left4[1] | ^ipnet.Mask[1]
-	right[2] = left4[2] | ^ipnet.Mask[2]
-	right[3] = left4[3] | ^ipnet.Mask[3]
-
-	return left4.String(), right.To4().String(), nil
+	right := make(net.IP, len(left))
+	for i := range left {
+		right[i] = left[i] | ^ipnet.Mask[i]
+	}
+	return left.String(), right.String(), nil
 }
 
 // ToDots converts a uint32 to a IPv4 Dotted notation
@@ -53,18 +37,60 @@ func ToDots(val uint32) string {
 		val&0xFF)
 }
 
-// Interval is a closed interval [a,b] of an IPv4 range
+// Interval is a closed interval [a,b] of an IPv4 or IPv6 range
 type Interval struct {
-	Left      uint32
-	Right     uint32
-	LeftDots  string
-	RightDots string
-	Name      string
-	URL       string
+	Left  Uint128
+	Right Uint128
+	Name  string
+	URL   string
+	Metadata
+
+	// insertion order, used to resolve overlaps
+	seq int
+}
+
+// LeftDots returns the start of the interval in text form
+func (i Interval) LeftDots() string {
+	return i.Left.String()
+}
+
+// RightDots returns the end of the interval in text form
+func (i Interval) RightDots() string {
+	return i.Right.String()
+}
+
+// LeftAddr returns the start of the interval as a netip.Addr
+func (i Interval) LeftAddr() netip.Addr {
+	return i.Left.Addr()
+}
+
+// RightAddr returns the end of the interval as a netip.Addr
+func (i Interval) RightAddr() netip.Addr {
+	return i.Right.Addr()
 }
 
 type intervallist []Interval
 
+// search returns the index of the interval containing val, or -1
+func (ipset intervallist) search(val Uint128) int {
+	i := sort.Search(len(ipset), func(i int) bool {
+		return !ipset[i].Left.Less(val)
+	})
+
+	// lots of cases in the lookup here.
+	// if exactly equals, then compare with [i]
+	if i < len(ipset) && ipset[i].Left == val {
+		return i
+	}
+
+	// ok then it's the record before
+	i--
+	if i >= 0 && !ipset[i].Right.Less(val) {
+		return i
+	}
+	return -1
+}
+
 // Len satisfies the sort.Sortable interface
 func (ipset intervallist) Len() int {
 	return len(ipset)
@@ -72,7 +98,10 @@ func (ipset intervallist) Len() int {
 
 // Less satisfies the sort.Sortable interface
 func (ipset intervallist) Less(i, j int) bool {
-	return ipset[i].Left < ipset[j].Left
+	if ipset[i].Left != ipset[j].Left {
+		return ipset[i].Left.Less(ipset[j].Left)
+	}
+	return ipset[i].seq < ipset[j].seq
 }
 
 // Swap satisfies the sort.Sortable interface
@@ -81,10 +110,19 @@ func (ipset intervallist) Swap(i, j int) {
 }
 
 // IntervalSet is a mapping of an IP range (the closed interval)
-// to additional data
+// to additional data.  It is not safe for concurrent use, even for
+// lookups, since it sorts lazily.  Use Snapshot to share it between
+// goroutines.
 type IntervalSet struct {
 	btree  intervallist
 	sorted bool
+	seq    int
+
+	policy   OverlapPolicy
+	priority map[string]int
+	overlaps []Overlap
+
+	aliases map[string]string
 }
 
 // NewIntervalSet creates a new set with a capacity
@@ -94,12 +132,15 @@ func NewIntervalSet(capacity int) *IntervalSet {
 	}
 }
 
-// ImportCSV imports data from a CSV file
+// ImportCSV imports data from a CSV file.  Both the classic four
+// column format and the extended format written by ExportCSVExtended
+// are accepted.
 func (ipset *IntervalSet) ImportCSV(in io.Reader) error {
 	ipset.btree = nil
 	ipset.sorted = false
 	line := 0
 	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
 	for {
 		line++
 		record, err := r.Read()
@@ -109,17 +150,35 @@ func (ipset *IntervalSet) ImportCSV(in io.Reader) error {
 		if err != nil {
 			return err
 		}
-		if len(record) != 4 {
-			return fmt.Errorf("line %d: expected 4 records but got %d %v", line, len(record), record)
+		rec, err := parseCSVRecord(record)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
 		}
-		if err = ipset.AddRange(record[0], record[1], record[2], record[3]); err != nil {
+		if err = ipset.AddInterval(rec); err != nil {
 			return err
 		}
 	}
 	return ipset.sort()
 }
 
-// ExportCSV export data to a CSV file
+// MergeCSV adds the records of a classic or extended CSV file to the
+// set, keeping the existing records
+func (ipset *IntervalSet) MergeCSV(in io.Reader) error {
+	tmp := NewIntervalSet(100)
+	if err := tmp.ImportCSV(in); err != nil {
+		return err
+	}
+	for _, rec := range tmp.btree {
+		if err := ipset.AddInterval(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportCSV export data to a CSV file in the classic four column
+// format.  Metadata is dropped and adjacent ranges with the same name
+// are written as one row.
 func (ipset *IntervalSet) ExportCSV(in io.Writer) error {
 	if !ipset.sorted {
 		err := ipset.sort()
@@ -128,9 +187,14 @@ func (ipset *IntervalSet) ExportCSV(in io.Writer) error {
 		}
 	}
 	w := csv.NewWriter(in)
-	for _, val := range ipset.btree {
-		rec := []string{ToDots(val.Left), ToDots(val.Right), val.Name, val.URL}
-		if err := w.Write(rec); err != nil {
+	for pos := 0; pos < len(ipset.btree); pos++ {
+		val := ipset.btree[pos]
+		for pos+1 < len(ipset.btree) && val.Right.add1() == ipset.btree[pos+1].Left &&
+			val.Name == ipset.btree[pos+1].Name {
+			pos++
+			val.Right = ipset.btree[pos].Right
+		}
+		if err := w.Write(val.csvRecord(false)); err != nil {
 			return err
 		}
 	}
@@ -150,36 +214,55 @@ func (ipset *IntervalSet) sort() error {
 	}
 	sort.Sort(ipset.btree)
 
-	last := Interval{}
 	// check validity -- probably worth ripping out
 	for pos, val := range ipset.btree {
-		if val.Left > val.Right {
-			return fmt.Errorf("left %d > right %d at pos %d",
+		if val.Right.Less(val.Left) {
+			return fmt.Errorf("left %s > right %s at pos %d",
 				val.Left, val.Right, pos)
 		}
-		if val.Right-val.Left > (uint32(255) << 24) {
-			return fmt.Errorf("Interval too large: [%d,%d]",
+		if tooLarge(val.Left, val.Right) {
+			return fmt.Errorf("Interval too large: [%s,%s]",
 				val.Left, val.Right)
 		}
-		if pos > 0 {
-			if val.Left <= last.Right || val.Right <= last.Right {
-				return fmt.Errorf("Overlapping regions %v vs. %v", last, val)
+	}
+
+	// find clusters of overlapping intervals and resolve them
+	ipset.overlaps = nil
+	resolved := make(intervallist, 0, len(ipset.btree))
+	for start := 0; start < len(ipset.btree); {
+		end := start + 1
+		maxRight, widest := ipset.btree[start].Right, start
+		for end < len(ipset.btree) && !maxRight.Less(ipset.btree[end].Left) {
+			if ipset.policy == OverlapReject {
+				a, b := ipset.btree[widest], ipset.btree[end]
+				return fmt.Errorf("Overlapping regions %s [%s,%s] vs. %s [%s,%s]",
+					a.Name, a.Left, a.Right, b.Name, b.Left, b.Right)
 			}
+			if maxRight.Less(ipset.btree[end].Right) {
+				maxRight, widest = ipset.btree[end].Right, end
+			}
+			end++
 		}
-		last = val
+		if end-start == 1 {
+			resolved = append(resolved, ipset.btree[start])
+		} else {
+			resolved = append(resolved, ipset.resolve(ipset.btree[start:end])...)
+		}
+		start = end
 	}
+	ipset.btree = resolved
 	ipset.sorted = true
 
 	// now merge adjacent items
 	newtree := make([]Interval, 0, len(ipset.btree))
-	last = Interval{}
+	last := Interval{}
 	for pos, val := range ipset.btree {
 		if pos == 0 {
 			newtree = append(newtree, val)
 			last = val
 			continue
 		}
-		if last.Right+1 == val.Left && last.Name == val.Name {
+		if last.Right.add1() == val.Left && last.Name == val.Name && last.Metadata == val.Metadata {
 			last.Right = val.Right
 			newtree[len(newtree)-1] = last
 			continue
@@ -193,43 +276,98 @@ func (ipset *IntervalSet) sort() error {
 
 // AddCIDR adds an entry based on a CIDR range
 func (ipset *IntervalSet) AddCIDR(cidr, name, url string) error {
-	dotsleft, dotsright, err := CIDR2Range(cidr)
+	p, err := netip.ParsePrefix(cidr)
 	if err != nil {
 		return err
 	}
-	return ipset.AddRange(dotsleft, dotsright, name, url)
+	return ipset.AddPrefix(p, name, url)
+}
+
+// AddCIDRMeta adds an entry with metadata based on a CIDR range
+func (ipset *IntervalSet) AddCIDRMeta(cidr, name, url string, meta Metadata) error {
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	return ipset.AddPrefixMeta(p, name, url, meta)
+}
+
+// AddPrefix adds an entry based on a netip.Prefix.  Any host bits
+// in the prefix are ignored.
+func (ipset *IntervalSet) AddPrefix(p netip.Prefix, name, url string) error {
+	return ipset.AddPrefixMeta(p, name, url, Metadata{})
+}
+
+// AddPrefixMeta adds an entry with metadata based on a netip.Prefix
+func (ipset *IntervalSet) AddPrefixMeta(p netip.Prefix, name, url string, meta Metadata) error {
+	if !p.IsValid() {
+		return fmt.Errorf("Invalid prefix %s", p)
+	}
+	left, right := prefixRange(p)
+	return ipset.AddInterval(Interval{
+		Left:     left,
+		Right:    right,
+		Name:     name,
+		URL:      url,
+		Metadata: meta,
+	})
 }
 
 // AddRange adds an entry based on an IP range
 func (ipset *IntervalSet) AddRange(dotsleft, dotsright, name, url string) error {
-	left := dots2uint32(dotsleft)
-	if left == 0 && dotsleft != "0.0.0.0" {
+	left, err := netip.ParseAddr(dotsleft)
+	if err != nil {
 		return fmt.Errorf("Unable to convert %s", dotsleft)
 	}
-	right := dots2uint32(dotsright)
-	if right == 0 && dotsright != "0.0.0.0" {
+	right, err := netip.ParseAddr(dotsright)
+	if err != nil {
 		return fmt.Errorf("Unable to convert %s", dotsright)
 	}
-	if left > right {
-		return fmt.Errorf("%s > %s", dotsleft, dotsright)
+	return ipset.AddAddrRange(left, right, name, url)
+}
+
+// AddAddrRange adds an entry based on an inclusive netip.Addr range
+func (ipset *IntervalSet) AddAddrRange(left, right netip.Addr, name, url string) error {
+	if !left.IsValid() || !right.IsValid() {
+		return fmt.Errorf("Invalid range [%s %s]", left, right)
+	}
+	return ipset.AddInterval(Interval{
+		Left:  Uint128FromAddr(left),
+		Right: Uint128FromAddr(right),
+		Name:  name,
+		URL:   url,
+	})
+}
+
+// AddInterval adds a copy of a complete record, including metadata
+func (ipset *IntervalSet) AddInterval(rec Interval) error {
+	left, right := rec.Left, rec.Right
+	if left.Is4() != right.Is4() {
+		return fmt.Errorf("Mixed IPv4 and IPv6 in [%s %s]", left, right)
+	}
+	if right.Less(left) {
+		return fmt.Errorf("%s > %s", left, right)
 	}
-	if right-left >= uint32(1)<<24 {
-		return fmt.Errorf("Range too big for [%s %s] %s %s", dotsleft, dotsright, name, url)
+	if tooLarge(left, right) {
+		return fmt.Errorf("Range too big for [%s %s] %s %s", left, right, rec.Name, rec.URL)
 	}
+	rec.seq = ipset.seq
+	ipset.seq++
 	ipset.sorted = false
-	ipset.btree = append(ipset.btree,
-		Interval{
-			Left:      left,
-			Right:     right,
-			LeftDots:  dotsleft,
-			RightDots: dotsright,
-			Name:      name,
-			URL:       url,
-		},
-	)
+	ipset.btree = append(ipset.btree, rec)
 	return nil
 }
 
+// tooLarge returns true if the interval is larger than an IPv4 /8
+// or an IPv6 /16
+func tooLarge(left, right Uint128) bool {
+	diff := right.sub(left)
+	if left.Is4() {
+		return diff.Hi != 0 || diff.Lo >= uint64(1)<<24
+	}
+	return diff.Hi >= uint64(1)<<48
+}
+
 // DeleteByName deletes all entries with the given name
 func (ipset *IntervalSet) DeleteByName(name string) {
 	newlist := intervallist{}
@@ -250,39 +388,40 @@ func (ipset IntervalSet) Len() int {
 // interval else nil or error.  It returns a pointer to the internal
 // record, so be careful.
 func (ipset IntervalSet) Contains(dots string) (*Interval, error) {
+	addr, err := netip.ParseAddr(dots)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid input: %q", dots)
+	}
+	return ipset.LookupAddr(addr)
+}
+
+// LookupAddr returns the internal record if the address is in some
+// interval else nil or error.  It does not allocate once the set is
+// sorted.  It returns a pointer to the internal record, so be careful.
+func (ipset *IntervalSet) LookupAddr(addr netip.Addr) (*Interval, error) {
 	if !ipset.sorted {
 		err := ipset.sort()
 		if err != nil {
 			return nil, err
 		}
 	}
-
-	val := dots2uint32(dots)
-	if val == 0 && dots != "0.0.0.0" {
-		return nil, fmt.Errorf("Invalid input: %q", dots)
-	}
-	i := sort.Search(len(ipset.btree), func(i int) bool {
-		return ipset.btree[i].Left >= val
-	})
-
-	// lots of cases in the lookup here.
-	// if exactly equals, then compare with [i]
-	if i < ipset.Len() && ipset.btree[i].Left == val && val <= ipset.btree[i].Right {
-		return &ipset.btree[i], nil
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("Invalid input: %s", addr)
 	}
-
-	// ok then it's the record before
-	i--
-	if i >= 0 && ipset.btree[i].Left < val && val <= ipset.btree[i].Right {
-		return &ipset.btree[i], nil
+	i := ipset.btree.search(Uint128FromAddr(addr))
+	if i < 0 {
+		return nil, nil
 	}
-	return nil, nil
+	return &ipset.btree[i], nil
 }
 
-// NameSize is a tuple mapping name with a size
+// NameSize is a tuple mapping name with a size.  Size counts IPv4
+// addresses and Size6 counts IPv6 /64 networks, since counting
+// individual IPv6 addresses overflows quickly and isn't meaningful.
 type NameSize struct {
-	Name string
-	Size int
+	Name  string
+	Size  int
+	Size6 int
 }
 
 // NameSizeList is a list of NameSize
@@ -357,23 +496,37 @@ func (ms *multiSorter) Less(i, j int) bool {
 // * Total number IP address
 //
 func (ipset IntervalSet) RankBySize() NameSizeList {
-	counts := make(map[string]int, ipset.Len())
+	counts := make(map[string]*NameSize, ipset.Len())
 	for _, val := range ipset.btree {
-		counts[val.Name] += int(val.Right-val.Left) + 1
+		ns, ok := counts[val.Name]
+		if !ok {
+			ns = &NameSize{Name: val.Name}
+			counts[val.Name] = ns
+		}
+		diff := val.Right.sub(val.Left)
+		if val.Left.Is4() {
+			ns.Size += int(diff.Lo) + 1
+		} else {
+			ns.Size6 += int(diff.rsh(64).Lo) + 1
+		}
 	}
 	rank := make(NameSizeList, 0, len(counts))
-	for k, v := range counts {
-		rank = append(rank, NameSize{k, v})
+	for _, v := range counts {
+		rank = append(rank, *v)
 	}
 
 	size := func(l1, l2 *NameSize) bool {
 		return l1.Size > l2.Size
 	}
 
+	size6 := func(l1, l2 *NameSize) bool {
+		return l1.Size6 > l2.Size6
+	}
+
 	name := func(l1, l2 *NameSize) bool {
 		return strings.ToLower(l1.Name) < strings.ToLower(l2.Name)
 	}
 
-	orderedBy(size, name).Sort(rank)
+	orderedBy(size, size6, name).Sort(rank)
 	return rank
 }
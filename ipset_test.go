@@ -1,6 +1,12 @@
 package ipcat
 
-import "testing"
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestSetting(t *testing.T) {
 	const (
@@ -67,6 +73,7 @@ var cidr2RangeTests = []struct {
 }{
 	{"10.0.0.0/8", "10.0.0.0", "10.255.255.255"},
 	{"192.168.0.0/24", "192.168.0.0", "192.168.0.255"},
+	{"2400:cb00::/32", "2400:cb00::", "2400:cb00:ffff:ffff:ffff:ffff:ffff:ffff"},
 }
 
 func TestCIDR2Range(t *testing.T) {
@@ -108,3 +115,212 @@ func TestIntervalSet(t *testing.T) {
 		t.Errorf("ipset.Contains(%q) record is not nil after DeleteByName: %v", "1.1.1.2", rec)
 	}
 }
+
+func TestIntervalSetIPv6(t *testing.T) {
+	ipset := NewIntervalSet(256)
+	if err := ipset.AddCIDR("2400:cb00::/32", "Test Range 6", "Test URL"); err != nil {
+		t.Fatalf("AddCIDR error: %s", err)
+	}
+	if err := ipset.AddCIDR("1.1.1.0/24", "Test Range", "Test URL"); err != nil {
+		t.Fatalf("AddCIDR error: %s", err)
+	}
+	if err := ipset.AddRange("2001::", "2001::ffff", "Test Range 6", "Test URL"); err != nil {
+		t.Fatalf("AddRange error: %s", err)
+	}
+	if err := ipset.AddRange("2001::", "1.1.1.1", "Busted", ""); err == nil {
+		t.Errorf("Allowed mixed address families")
+	}
+	if err := ipset.AddCIDR("2400::/8", "Busted", ""); err == nil {
+		t.Errorf("Allowed adding something larger than a /16")
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"2400:cb00::1", "Test Range 6"},
+		{"2400:cb00:ffff:ffff:ffff:ffff:ffff:ffff", "Test Range 6"},
+		{"2001::ffff", "Test Range 6"},
+		{"1.1.1.1", "Test Range"},
+		{"::ffff:1.1.1.1", "Test Range"},
+		{"2400:cb01::", ""},
+		{"2001::1:0", ""},
+	}
+	for _, tt := range tests {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %s", tt.ip, err)
+		}
+		got := ""
+		if rec != nil {
+			got = rec.Name
+		}
+		if got != tt.want {
+			t.Errorf("ipset.Contains(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	rank := ipset.RankBySize()
+	if len(rank) != 2 {
+		t.Fatalf("RankBySize() returned %d entries, want 2", len(rank))
+	}
+	for _, ns := range rank {
+		switch ns.Name {
+		case "Test Range":
+			if ns.Size != 256 || ns.Size6 != 0 {
+				t.Errorf("RankBySize() %q = %d/%d, want 256/0", ns.Name, ns.Size, ns.Size6)
+			}
+		case "Test Range 6":
+			if ns.Size != 0 || ns.Size6 != 1<<32+1 {
+				t.Errorf("RankBySize() %q = %d/%d, want 0/%d", ns.Name, ns.Size, ns.Size6, 1<<32+1)
+			}
+		}
+	}
+}
+
+func TestCSVRoundTripIPv6(t *testing.T) {
+	const data = "1.0.0.0,1.0.0.255,A,http://a\n2400:cb00::,2400:cb00:ffff:ffff:ffff:ffff:ffff:ffff,B,http://b\n"
+	ipset := NewIntervalSet(10)
+	if err := ipset.ImportCSV(strings.NewReader(data)); err != nil {
+		t.Fatalf("ImportCSV error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := ipset.ExportCSV(&buf); err != nil {
+		t.Fatalf("ExportCSV error: %s", err)
+	}
+	if buf.String() != data {
+		t.Errorf("ExportCSV() = %q, want %q", buf.String(), data)
+	}
+}
+
+func TestLookupAddr(t *testing.T) {
+	ipset := NewIntervalSet(10)
+	if err := ipset.AddPrefix(netip.MustParsePrefix("10.1.2.3/16"), "Ten", "http://ten"); err != nil {
+		t.Fatalf("AddPrefix error: %s", err)
+	}
+	if err := ipset.AddPrefix(netip.MustParsePrefix("2600:1f00::/24"), "Six", "http://six"); err != nil {
+		t.Fatalf("AddPrefix error: %s", err)
+	}
+	if err := ipset.AddPrefix(netip.Prefix{}, "Busted", ""); err == nil {
+		t.Errorf("Allowed invalid prefix")
+	}
+
+	rec, err := ipset.LookupAddr(netip.MustParseAddr("10.1.0.0"))
+	if err != nil {
+		t.Fatalf("LookupAddr error: %s", err)
+	}
+	if rec == nil || rec.Name != "Ten" {
+		t.Fatalf("LookupAddr(10.1.0.0) = %v, want Ten", rec)
+	}
+	if got := rec.LeftDots(); got != "10.1.0.0" {
+		t.Errorf("LeftDots() = %q, want %q", got, "10.1.0.0")
+	}
+	if got := rec.RightAddr(); got != netip.MustParseAddr("10.1.255.255") {
+		t.Errorf("RightAddr() = %s, want 10.1.255.255", got)
+	}
+
+	rec, err = ipset.LookupAddr(netip.MustParseAddr("2600:1f00::1"))
+	if err != nil {
+		t.Fatalf("LookupAddr error: %s", err)
+	}
+	if rec == nil || rec.Name != "Six" {
+		t.Errorf("LookupAddr(2600:1f00::1) = %v, want Six", rec)
+	}
+	if _, err := ipset.LookupAddr(netip.Addr{}); err == nil {
+		t.Errorf("LookupAddr(zero Addr) did not return an error")
+	}
+
+	addr := netip.MustParseAddr("10.1.200.1")
+	allocs := testing.AllocsPerRun(100, func() {
+		ipset.LookupAddr(addr)
+	})
+	if allocs != 0 {
+		t.Errorf("LookupAddr allocates %v times, want 0", allocs)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	meta := Metadata{
+		Category: CategoryCloud,
+		Region:   "eu-west-1",
+		Service:  "EC2",
+		ASN:      16509,
+		Source:   "aws",
+		Country:  "IE",
+		City:     "Dublin",
+		Postal:   "D02",
+		LastSeen: time.Date(2026, 10, 17, 17, 1, 58, 0, time.UTC),
+	}
+	ipset := NewIntervalSet(10)
+	if err := ipset.AddCIDRMeta("52.95.0.0/24", "Amazon AWS", "http://aws", meta); err != nil {
+		t.Fatalf("AddCIDRMeta error: %s", err)
+	}
+	if err := ipset.AddCIDRMeta("52.95.1.0/24", "Amazon AWS", "http://aws", Metadata{Region: "us-east-1"}); err != nil {
+		t.Fatalf("AddCIDRMeta error: %s", err)
+	}
+	if err := ipset.AddCIDR("2a05:d000::/25", "Other", "http://other"); err != nil {
+		t.Fatalf("AddCIDR error: %s", err)
+	}
+
+	var classic bytes.Buffer
+	if err := ipset.ExportCSV(&classic); err != nil {
+		t.Fatalf("ExportCSV error: %s", err)
+	}
+	want := "52.95.0.0,52.95.1.255,Amazon AWS,http://aws\n2a05:d000::,2a05:d07f:ffff:ffff:ffff:ffff:ffff:ffff,Other,http://other\n"
+	if classic.String() != want {
+		t.Errorf("ExportCSV() = %q, want %q", classic.String(), want)
+	}
+
+	var extended bytes.Buffer
+	if err := ipset.ExportCSVExtended(&extended); err != nil {
+		t.Fatalf("ExportCSVExtended error: %s", err)
+	}
+	var js bytes.Buffer
+	if err := ipset.ExportJSON(&js); err != nil {
+		t.Fatalf("ExportJSON error: %s", err)
+	}
+
+	for _, tt := range []struct {
+		format string
+		load   func(*IntervalSet) error
+	}{
+		{"csv", func(s *IntervalSet) error { return s.ImportCSV(bytes.NewReader(extended.Bytes())) }},
+		{"json", func(s *IntervalSet) error { return s.ImportJSON(bytes.NewReader(js.Bytes())) }},
+	} {
+		got := NewIntervalSet(10)
+		if err := tt.load(got); err != nil {
+			t.Fatalf("%s import error: %s", tt.format, err)
+		}
+		if got.Len() != 3 {
+			t.Errorf("%s import has %d records, want 3", tt.format, got.Len())
+		}
+		rec, err := got.Contains("52.95.0.1")
+		if err != nil || rec == nil {
+			t.Fatalf("%s import Contains(52.95.0.1) = %v, %v", tt.format, rec, err)
+		}
+		if rec.Metadata != meta {
+			t.Errorf("%s import metadata = %+v, want %+v", tt.format, rec.Metadata, meta)
+		}
+	}
+}
+
+func TestMergeCSV(t *testing.T) {
+	ipset := NewIntervalSet(10)
+	ipset.AddCIDR("192.0.2.0/24", "Existing", "")
+	review := "198.51.100.0,198.51.100.255,Reviewed,https://example.com/,hosting,,,,ripe,NL\n"
+	if err := ipset.MergeCSV(strings.NewReader(review)); err != nil {
+		t.Fatalf("MergeCSV error: %s", err)
+	}
+	for _, tt := range []struct {
+		ip   string
+		name string
+	}{
+		{"192.0.2.1", "Existing"},
+		{"198.51.100.1", "Reviewed"},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil || rec == nil || rec.Name != tt.name {
+			t.Errorf("Contains(%q) = %v, %v, want %s", tt.ip, rec, err, tt.name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package ipcat
+
+import (
+	"iter"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// All returns an iterator over copies of the records in address
+// order.  If the overlap policy fails, for instance because of
+// rejected overlaps, the records are still in address order but
+// overlapping ones are not resolved.  Call Resolve first, or use
+// RangesByName, to see the error.
+func (ipset *IntervalSet) All() iter.Seq[Interval] {
+	return func(yield func(Interval) bool) {
+		ipset.sort()
+		for _, rec := range ipset.btree {
+			if !yield(rec) {
+				return
+			}
+		}
+	}
+}
+
+// ByName returns an iterator over the records matching a provider
+// name.  Matching is case-insensitive and follows aliases added with
+// AddAlias.
+func (ipset *IntervalSet) ByName(name string) iter.Seq[Interval] {
+	return func(yield func(Interval) bool) {
+		want := ipset.canonicalName(name)
+		for rec := range ipset.All() {
+			if ipset.canonicalName(rec.Name) == want && !yield(rec) {
+				return
+			}
+		}
+	}
+}
+
+// RangesByName returns the records matching a provider name, in
+// address order, or the error of the overlap policy.  See ByName.
+func (ipset *IntervalSet) RangesByName(name string) ([]Interval, error) {
+	if err := ipset.sort(); err != nil {
+		return nil, err
+	}
+	return slices.Collect(ipset.ByName(name)), nil
+}
+
+// AddAlias makes alias match name in ByName and RangesByName, for
+// example AddAlias("DigitalOcean USA", "DigitalOcean").  Aliases are
+// case-insensitive and are not followed transitively.
+func (ipset *IntervalSet) AddAlias(alias, name string) {
+	if ipset.aliases == nil {
+		ipset.aliases = make(map[string]string)
+	}
+	ipset.aliases[strings.ToLower(alias)] = strings.ToLower(name)
+}
+
+// canonicalName returns the lower case name an alias refers to
+func (ipset *IntervalSet) canonicalName(name string) string {
+	name = strings.ToLower(name)
+	if target, ok := ipset.aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// Prefixes decomposes the interval into the minimal list of CIDR
+// prefixes covering it exactly
+func (i Interval) Prefixes() []netip.Prefix {
+	list := blocks(i.Left, i.Right)
+	out := make([]netip.Prefix, 0, len(list))
+	for _, b := range list {
+		addr := b.start.Addr()
+		bits := b.bits
+		if addr.Is4() {
+			bits -= 128 - 32
+		}
+		out = append(out, netip.PrefixFrom(addr, bits))
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package ipcat
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestRangesByName(t *testing.T) {
+	ipset := NewIntervalSet(10)
+	ipset.AddCIDR("104.131.0.0/16", "DigitalOcean", "")
+	ipset.AddCIDR("5.101.96.0/21", "DigitalOcean Europe", "")
+	ipset.AddCIDR("2604:a880::/32", "digitalocean", "")
+	ipset.AddCIDR("45.33.0.0/17", "Linode", "")
+	ipset.AddAlias("DigitalOcean Europe", "DigitalOcean")
+
+	var names []string
+	for rec := range ipset.All() {
+		names = append(names, rec.Name)
+	}
+	want := []string{"DigitalOcean Europe", "Linode", "DigitalOcean", "digitalocean"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("All() = %v, want %v", names, want)
+	}
+
+	got, err := ipset.RangesByName("DIGITALOCEAN")
+	if err != nil {
+		t.Fatalf("RangesByName() error: %s", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("RangesByName() returned %d records, want 3: %v", len(got), got)
+	}
+	if got[0].Name != "DigitalOcean Europe" {
+		t.Errorf("RangesByName()[0] = %q, want DigitalOcean Europe", got[0].Name)
+	}
+	if got, _ := ipset.RangesByName("digitalocean europe"); len(got) != 3 {
+		t.Errorf("RangesByName(alias) returned %d records, want 3", len(got))
+	}
+
+	// early exit from the iterator
+	count := 0
+	for range ipset.ByName("DigitalOcean") {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("ByName() yielded %d records after break, want 1", count)
+	}
+
+	ipset.AddCIDR("104.131.1.0/24", "Overlap", "")
+	if _, err := ipset.RangesByName("DigitalOcean"); err == nil {
+		t.Errorf("RangesByName() with rejected overlaps did not return an error")
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	tests := []struct {
+		left, right string
+		want        []string
+	}{
+		{"10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"1.0.0.0", "1.255.255.255", []string{"1.0.0.0/8"}},
+		{"2001:db8::", "2001:db8::1:ffff", []string{"2001:db8::/111"}},
+	}
+	for _, tt := range tests {
+		rec := Interval{
+			Left:  Uint128FromAddr(netip.MustParseAddr(tt.left)),
+			Right: Uint128FromAddr(netip.MustParseAddr(tt.right)),
+		}
+		var got []string
+		for _, p := range rec.Prefixes() {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Prefixes(%s-%s) = %v, want %v", tt.left, tt.right, got, tt.want)
+		}
+	}
+}
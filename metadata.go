@@ -0,0 +1,225 @@
+package ipcat
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Category is a broad classification of a provider
+type Category string
+
+// Known provider categories
+const (
+	CategoryCloud   Category = "cloud"
+	CategoryCDN     Category = "cdn"
+	CategoryHosting Category = "hosting"
+	CategoryVPN     Category = "vpn"
+	CategoryCrawler Category = "crawler"
+	CategoryTorExit Category = "tor-exit"
+	CategoryRelay   Category = "relay"
+)
+
+// Metadata holds optional structured attributes of an Interval.  The
+// zero value means "unknown".
+type Metadata struct {
+	Category Category `json:"category,omitempty"`
+	Region   string   `json:"region,omitempty"`
+	Service  string   `json:"service,omitempty"`
+	ASN      uint32   `json:"asn,omitempty"`
+	Source   string   `json:"source,omitempty"`
+	Country  string   `json:"country,omitempty"`
+	City     string   `json:"city,omitempty"`
+	Postal   string   `json:"postal,omitempty"`
+
+	// LastSeen is when the range was last observed in use, for
+	// short-lived entries such as Tor exits.  It is in UTC with
+	// second precision.
+	LastSeen time.Time `json:"last_seen,omitzero"`
+}
+
+// extendedColumns are the columns written by ExportCSVExtended.  The
+// first four match the classic datacenters.csv format, new columns are
+// only ever appended so older files stay readable.
+var extendedColumns = []string{
+	"start", "end", "name", "url",
+	"category", "region", "service", "asn", "source",
+	"country", "city", "postal", "last_seen",
+}
+
+// csvRecord converts an interval to a CSV row.  Classic rows only have
+// the first four columns.
+func (i Interval) csvRecord(extended bool) []string {
+	rec := []string{i.Left.String(), i.Right.String(), i.Name, i.URL}
+	if !extended {
+		return rec
+	}
+	asn := ""
+	if i.ASN != 0 {
+		asn = strconv.FormatUint(uint64(i.ASN), 10)
+	}
+	lastSeen := ""
+	if !i.LastSeen.IsZero() {
+		lastSeen = i.LastSeen.Format(time.RFC3339)
+	}
+	return append(rec, string(i.Category), i.Region, i.Service, asn, i.Source,
+		i.Country, i.City, i.Postal, lastSeen)
+}
+
+// parseCSVRecord converts a classic or extended CSV row to an interval
+func parseCSVRecord(record []string) (Interval, error) {
+	if len(record) < 4 || len(record) > len(extendedColumns) {
+		return Interval{}, fmt.Errorf("expected 4 to %d records but got %d %v",
+			len(extendedColumns), len(record), record)
+	}
+	left, err := netip.ParseAddr(record[0])
+	if err != nil {
+		return Interval{}, fmt.Errorf("Unable to convert %s", record[0])
+	}
+	right, err := netip.ParseAddr(record[1])
+	if err != nil {
+		return Interval{}, fmt.Errorf("Unable to convert %s", record[1])
+	}
+	rec := Interval{
+		Left:  Uint128FromAddr(left),
+		Right: Uint128FromAddr(right),
+		Name:  record[2],
+		URL:   record[3],
+	}
+	// pad so missing trailing columns are empty
+	for len(record) < len(extendedColumns) {
+		record = append(record, "")
+	}
+	rec.Category = Category(record[4])
+	rec.Region = record[5]
+	rec.Service = record[6]
+	if record[7] != "" {
+		asn, err := parseASN(record[7])
+		if err != nil {
+			return Interval{}, err
+		}
+		rec.ASN = asn
+	}
+	rec.Source = record[8]
+	rec.Country = record[9]
+	rec.City = record[10]
+	rec.Postal = record[11]
+	if record[12] != "" {
+		t, err := time.Parse(time.RFC3339, record[12])
+		if err != nil {
+			return Interval{}, fmt.Errorf("Invalid last seen time %q", record[12])
+		}
+		rec.LastSeen = t.UTC()
+	}
+	return rec, nil
+}
+
+// parseASN parses "AS1234" or "1234"
+func parseASN(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "AS")
+	asn, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid ASN %q", s)
+	}
+	return uint32(asn), nil
+}
+
+// ExportCSVExtended exports data to a CSV file with the metadata
+// columns start, end, name, url, category, region, service, asn,
+// source, country, city, postal and last_seen.  The output can be read
+// back with ImportCSV.
+func (ipset *IntervalSet) ExportCSVExtended(out io.Writer) error {
+	if err := ipset.sort(); err != nil {
+		return err
+	}
+	w := csv.NewWriter(out)
+	for _, val := range ipset.btree {
+		if err := w.Write(val.csvRecord(true)); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// intervalJSON is the JSON form of an Interval
+type intervalJSON struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Name  string `json:"name"`
+	URL   string `json:"url,omitempty"`
+	Metadata
+}
+
+// MarshalJSON satisfies the json.Marshaler interface
+func (i Interval) MarshalJSON() ([]byte, error) {
+	return json.Marshal(intervalJSON{
+		Start:    i.Left.String(),
+		End:      i.Right.String(),
+		Name:     i.Name,
+		URL:      i.URL,
+		Metadata: i.Metadata,
+	})
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface
+func (i *Interval) UnmarshalJSON(b []byte) error {
+	var raw intervalJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	left, err := netip.ParseAddr(raw.Start)
+	if err != nil {
+		return fmt.Errorf("Unable to convert %s", raw.Start)
+	}
+	right, err := netip.ParseAddr(raw.End)
+	if err != nil {
+		return fmt.Errorf("Unable to convert %s", raw.End)
+	}
+	*i = Interval{
+		Left:     Uint128FromAddr(left),
+		Right:    Uint128FromAddr(right),
+		Name:     raw.Name,
+		URL:      raw.URL,
+		Metadata: raw.Metadata,
+	}
+	i.LastSeen = i.LastSeen.UTC()
+	return nil
+}
+
+// ImportJSON imports data from a JSON array of intervals as written
+// by ExportJSON
+func (ipset *IntervalSet) ImportJSON(in io.Reader) error {
+	var list []Interval
+	if err := json.NewDecoder(in).Decode(&list); err != nil {
+		return err
+	}
+	ipset.btree = nil
+	ipset.sorted = false
+	for _, rec := range list {
+		if err := ipset.AddInterval(rec); err != nil {
+			return err
+		}
+	}
+	return ipset.sort()
+}
+
+// ExportJSON exports data as a JSON array of intervals, including
+// any metadata
+func (ipset *IntervalSet) ExportJSON(out io.Writer) error {
+	if err := ipset.sort(); err != nil {
+		return err
+	}
+	list := ipset.btree
+	if list == nil {
+		list = intervallist{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list)
+}
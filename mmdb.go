@@ -0,0 +1,617 @@
+package ipcat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// MaxMind DB support, see https://maxmind.github.io/MaxMind-DB/
+//
+// The database written is an IPv6 tree with IPv4 addresses stored at
+// ::a.b.c.d/96 and aliased from ::ffff:0:0/96.  Each record is a map
+// with the keys name, url, category, region, service, asn, source,
+// country, city, postal and last_seen, the last as Unix seconds.
+
+// mmdbMetadataMarker starts the metadata section
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errMMDB is returned for malformed MaxMind DB data
+var errMMDB = errors.New("ipcat: invalid MaxMind DB data")
+
+// MaxMind DB data types
+const (
+	mmdbExtended = 0
+	mmdbPointer  = 1
+	mmdbString   = 2
+	mmdbDouble   = 3
+	mmdbBytes    = 4
+	mmdbUint16   = 5
+	mmdbUint32   = 6
+	mmdbMap      = 7
+	mmdbInt32    = 8
+	mmdbUint64   = 9
+	mmdbUint128  = 10
+	mmdbArray    = 11
+	mmdbBool     = 14
+	mmdbFloat    = 15
+)
+
+// mmdbV4Depth is where the IPv4 subtree starts in an IPv6 tree
+const mmdbV4Depth = 96
+
+// mmdbRecord is one half of a search tree node while building
+type mmdbRecord struct {
+	kind int // mmdbEmpty, mmdbNode or mmdbData
+	val  int
+}
+
+const (
+	mmdbEmpty = iota
+	mmdbNode
+	mmdbData
+)
+
+// mmdbWriter builds a search tree and data section
+type mmdbWriter struct {
+	nodes [][2]mmdbRecord
+	data  []byte
+	cache map[string]int
+}
+
+// node returns the node index the record points to, creating it
+func (w *mmdbWriter) node(parent, bit int) int {
+	rec := &w.nodes[parent][bit]
+	if rec.kind != mmdbNode {
+		w.nodes = append(w.nodes, [2]mmdbRecord{})
+		w.nodes[parent][bit] = mmdbRecord{kind: mmdbNode, val: len(w.nodes) - 1}
+	}
+	return w.nodes[parent][bit].val
+}
+
+// insert sets the record for a block in the 128-bit keyspace
+func (w *mmdbWriter) insert(start Uint128, bits int, rec mmdbRecord) {
+	n := 0
+	for depth := 0; depth < bits-1; depth++ {
+		n = w.node(n, start.bit(depth))
+	}
+	w.nodes[n][start.bit(bits-1)] = rec
+}
+
+// appendControl appends a control byte, extended type and size
+func appendControl(buf []byte, typ, size int) []byte {
+	ctrl := byte(0)
+	if typ <= 7 {
+		ctrl = byte(typ << 5)
+	}
+	var ext []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 29+256:
+		ctrl |= 29
+		ext = []byte{byte(size - 29)}
+	case size < 285+65536:
+		ctrl |= 30
+		ext = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		ctrl |= 31
+		size -= 65821
+		ext = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	}
+	buf = append(buf, ctrl)
+	if typ > 7 {
+		buf = append(buf, byte(typ-7))
+	}
+	return append(buf, ext...)
+}
+
+func appendMMDBString(buf []byte, s string) []byte {
+	return append(appendControl(buf, mmdbString, len(s)), s...)
+}
+
+func appendMMDBUint(buf []byte, typ int, v uint64) []byte {
+	n := (64 - bits.LeadingZeros64(v) + 7) / 8
+	buf = appendControl(buf, typ, n)
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, byte(v>>(8*uint(i))))
+	}
+	return buf
+}
+
+// appendMMDBMap appends a map with string keys and values of type
+// string, uint16, uint32, uint64, []string or map[string]string
+func appendMMDBMap(buf []byte, keys []string, vals map[string]interface{}) []byte {
+	buf = appendControl(buf, mmdbMap, len(keys))
+	for _, k := range keys {
+		buf = appendMMDBString(buf, k)
+		switch v := vals[k].(type) {
+		case string:
+			buf = appendMMDBString(buf, v)
+		case uint16:
+			buf = appendMMDBUint(buf, mmdbUint16, uint64(v))
+		case uint32:
+			buf = appendMMDBUint(buf, mmdbUint32, uint64(v))
+		case uint64:
+			buf = appendMMDBUint(buf, mmdbUint64, v)
+		case []string:
+			buf = appendControl(buf, mmdbArray, len(v))
+			for _, s := range v {
+				buf = appendMMDBString(buf, s)
+			}
+		case map[string]string:
+			sub := make([]string, 0, len(v))
+			subvals := make(map[string]interface{}, len(v))
+			for sk, sv := range v {
+				sub = append(sub, sk)
+				subvals[sk] = sv
+			}
+			buf = appendMMDBMap(buf, sub, subvals)
+		}
+	}
+	return buf
+}
+
+// mmdbFields returns the keys and values stored for an interval
+func (i *Interval) mmdbFields() ([]string, map[string]interface{}) {
+	keys := []string{"name"}
+	vals := map[string]interface{}{"name": i.Name}
+	add := func(k, v string) {
+		if v != "" {
+			keys = append(keys, k)
+			vals[k] = v
+		}
+	}
+	add("url", i.URL)
+	add("category", string(i.Category))
+	add("region", i.Region)
+	add("service", i.Service)
+	if i.ASN != 0 {
+		keys = append(keys, "asn")
+		vals["asn"] = i.ASN
+	}
+	add("source", i.Source)
+	add("country", i.Country)
+	add("city", i.City)
+	add("postal", i.Postal)
+	if !i.LastSeen.IsZero() {
+		keys = append(keys, "last_seen")
+		vals["last_seen"] = uint64(i.LastSeen.Unix())
+	}
+	return keys, vals
+}
+
+// dataRecord returns the record pointing at the data for an interval,
+// writing it to the data section if it is new
+func (w *mmdbWriter) dataRecord(rec *Interval) mmdbRecord {
+	keys, vals := rec.mmdbFields()
+	enc := appendMMDBMap(nil, keys, vals)
+	off, ok := w.cache[string(enc)]
+	if !ok {
+		off = len(w.data)
+		w.data = append(w.data, enc...)
+		w.cache[string(enc)] = off
+	}
+	return mmdbRecord{kind: mmdbData, val: off}
+}
+
+// mmdbKey maps a set key to the MaxMind IPv6 keyspace, where IPv4
+// lives at ::a.b.c.d rather than ::ffff:a.b.c.d
+func mmdbKey(u Uint128) Uint128 {
+	if u.Is4() {
+		return Uint128{Lo: u.Lo & math.MaxUint32}
+	}
+	return u
+}
+
+// ExportMMDB writes the set as a MaxMind DB file, with built as its
+// build_epoch.  The same set and time always give the same file.
+func (ipset *IntervalSet) ExportMMDB(out io.Writer, built time.Time) error {
+	if err := ipset.sort(); err != nil {
+		return err
+	}
+	w := &mmdbWriter{
+		nodes: make([][2]mmdbRecord, 1, 2*len(ipset.btree)),
+		cache: make(map[string]int),
+	}
+	hasV4 := false
+	for i := range ipset.btree {
+		rec := &ipset.btree[i]
+		data := w.dataRecord(rec)
+		hasV4 = hasV4 || rec.Left.Is4()
+		for _, b := range blocks(mmdbKey(rec.Left), mmdbKey(rec.Right)) {
+			w.insert(b.start, b.bits, data)
+		}
+	}
+	if hasV4 {
+		// alias ::ffff:0:0/96 to the IPv4 subtree at ::/96
+		v4root := 0
+		for depth := 0; depth < mmdbV4Depth; depth++ {
+			v4root = w.node(v4root, 0)
+		}
+		mapped := Uint128{Lo: v4MappedLo}
+		w.insert(mapped, mmdbV4Depth, mmdbRecord{kind: mmdbNode, val: v4root})
+	}
+
+	nodeCount := len(w.nodes)
+	value := func(r mmdbRecord) uint64 {
+		switch r.kind {
+		case mmdbNode:
+			return uint64(r.val)
+		case mmdbData:
+			return uint64(nodeCount) + 16 + uint64(r.val)
+		}
+		return uint64(nodeCount)
+	}
+	maxValue := uint64(nodeCount) + 16 + uint64(len(w.data))
+	recordSize := 24
+	switch {
+	case maxValue >= 1<<32:
+		return errors.New("ipcat: too much data for a MaxMind DB")
+	case maxValue >= 1<<28:
+		recordSize = 32
+	case maxValue >= 1<<24:
+		recordSize = 28
+	}
+
+	buf := make([]byte, 0, nodeCount*recordSize/4+16+len(w.data)+256)
+	for _, n := range w.nodes {
+		l, r := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(l>>16), byte(l>>8), byte(l),
+				byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			buf = append(buf, byte(l>>16), byte(l>>8), byte(l),
+				byte((l>>24)<<4|(r>>24)&0x0f),
+				byte(r>>16), byte(r>>8), byte(r))
+		case 32:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(l))
+			buf = binary.BigEndian.AppendUint32(buf, uint32(r))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, w.data...)
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = appendMMDBMap(buf, []string{
+		"binary_format_major_version",
+		"binary_format_minor_version",
+		"build_epoch",
+		"database_type",
+		"description",
+		"ip_version",
+		"languages",
+		"node_count",
+		"record_size",
+	}, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(built.Unix()),
+		"database_type":               "ipcat",
+		"description":                 map[string]string{"en": "ipcat datacenter ranges"},
+		"ip_version":                  uint16(6),
+		"languages":                   []string{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+	})
+	_, err := out.Write(buf)
+	return err
+}
+
+// mmdbDecoder decodes values from a data or metadata section
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset following it.
+// Maps are map[string]interface{}, arrays []interface{}, unsigned
+// integers uint64, int32 int64, and floats float64.
+func (d *mmdbDecoder) decode(off int, depth int) (interface{}, int, error) {
+	if depth > 32 || off < 0 || off >= len(d.buf) {
+		return nil, 0, errMMDB
+	}
+	ctrl := d.buf[off]
+	off++
+	typ := int(ctrl >> 5)
+	if typ == mmdbPointer {
+		ss := int(ctrl>>3) & 0x3
+		if off+ss+1 > len(d.buf) {
+			return nil, 0, errMMDB
+		}
+		p := int(ctrl & 0x7)
+		switch ss {
+		case 0:
+			p = p<<8 | int(d.buf[off])
+		case 1:
+			p = (p<<16 | int(d.buf[off])<<8 | int(d.buf[off+1])) + 2048
+		case 2:
+			p = (p<<24 | int(d.buf[off])<<16 | int(d.buf[off+1])<<8 | int(d.buf[off+2])) + 526336
+		case 3:
+			p = int(binary.BigEndian.Uint32(d.buf[off:]))
+		}
+		val, _, err := d.decode(p, depth+1)
+		return val, off + ss + 1, err
+	}
+	if typ == mmdbExtended {
+		if off >= len(d.buf) {
+			return nil, 0, errMMDB
+		}
+		typ = int(d.buf[off]) + 7
+		off++
+	}
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if off+n > len(d.buf) {
+			return nil, 0, errMMDB
+		}
+		v := 0
+		for _, b := range d.buf[off : off+n] {
+			v = v<<8 | int(b)
+		}
+		size = v + []int{29, 285, 65821}[n-1]
+		off += n
+	}
+
+	switch typ {
+	case mmdbMap:
+		// every key and value takes at least a byte
+		if size > (len(d.buf)-off)/2 {
+			return nil, 0, errMMDB
+		}
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			k, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errMMDB
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			off = next
+		}
+		return m, off, nil
+	case mmdbArray:
+		if size > len(d.buf)-off {
+			return nil, 0, errMMDB
+		}
+		a := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			v, next, err := d.decode(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case mmdbBool:
+		return size != 0, off, nil
+	}
+
+	if off+size > len(d.buf) {
+		return nil, 0, errMMDB
+	}
+	payload := d.buf[off : off+size]
+	off += size
+	switch typ {
+	case mmdbString:
+		return string(payload), off, nil
+	case mmdbBytes:
+		return append([]byte(nil), payload...), off, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDB
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), off, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDB
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), off, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, 0, errMMDB
+		}
+		var v uint64
+		for _, b := range payload {
+			v = v<<8 | uint64(b)
+		}
+		if typ == mmdbInt32 {
+			return int64(int32(v)), off, nil
+		}
+		return v, off, nil
+	case mmdbUint128:
+		return append([]byte(nil), payload...), off, nil
+	}
+	return nil, 0, fmt.Errorf("ipcat: unsupported MaxMind DB type %d", typ)
+}
+
+// ImportMMDB adds the records of a MaxMind DB file to the set.  The
+// provider name is read from the nameKey field of each record, "name"
+// if empty, and records without one are skipped.  The url, category,
+// region, service, asn and source fields are read if present, with
+// autonomous_system_number as a fallback for asn.  Networks larger
+// than the set allows are split.  Existing records are kept, so
+// combine this with an overlap policy when merging several sources.
+func (ipset *IntervalSet) ImportMMDB(data []byte, nameKey string) error {
+	if nameKey == "" {
+		nameKey = "name"
+	}
+	start := bytes.LastIndex(data, mmdbMetadataMarker)
+	if start == -1 {
+		return errors.New("ipcat: MaxMind DB metadata not found")
+	}
+	meta := &mmdbDecoder{buf: data[start+len(mmdbMetadataMarker):]}
+	val, _, err := meta.decode(0, 0)
+	if err != nil {
+		return err
+	}
+	md, ok := val.(map[string]interface{})
+	if !ok {
+		return errMMDB
+	}
+	nodeCount, _ := md["node_count"].(uint64)
+	recordSize, _ := md["record_size"].(uint64)
+	ipVersion, _ := md["ip_version"].(uint64)
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return fmt.Errorf("ipcat: unsupported MaxMind DB record size %d", recordSize)
+	}
+	if nodeCount > uint64(start)/(recordSize/4) {
+		return errMMDB
+	}
+	treeSize := nodeCount * recordSize / 4
+	if treeSize+16 > uint64(start) {
+		return errMMDB
+	}
+	tree := data[:treeSize]
+	dec := &mmdbDecoder{buf: data[treeSize+16 : start]}
+
+	record := func(node uint64, bit int) uint64 {
+		b := tree[node*recordSize/4:]
+		switch recordSize {
+		case 24:
+			b = b[3*bit:]
+			return uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		case 28:
+			if bit == 0 {
+				return uint64(b[3]>>4)<<24 | uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+			}
+			return uint64(b[3]&0x0f)<<24 | uint64(b[4])<<16 | uint64(b[5])<<8 | uint64(b[6])
+		}
+		return uint64(binary.BigEndian.Uint32(b[4*bit:]))
+	}
+
+	maxDepth := 128
+	v4root := uint64(0)
+	if ipVersion == 4 {
+		maxDepth = 32
+	} else {
+		for depth := 0; depth < mmdbV4Depth && v4root < nodeCount; depth++ {
+			v4root = record(v4root, 0)
+		}
+	}
+
+	cache := make(map[uint64]*Interval)
+	var walk func(node uint64, key Uint128, depth int) error
+	walk = func(node uint64, key Uint128, depth int) error {
+		if depth >= maxDepth {
+			return errMMDB
+		}
+		for bit := 0; bit < 2; bit++ {
+			k := key
+			if bit == 1 {
+				k = k.or(Uint128{Lo: 1}.lsh(uint(127 - depth)))
+			}
+			r := record(node, bit)
+			switch {
+			case r < nodeCount:
+				// skip aliases of the IPv4 subtree such as ::ffff:0:0/96
+				if ipVersion != 4 && r == v4root && !(depth+1 == mmdbV4Depth && k == Uint128{}) {
+					continue
+				}
+				if err := walk(r, k, depth+1); err != nil {
+					return err
+				}
+			case r > nodeCount:
+				rec, ok := cache[r]
+				if !ok {
+					val, _, err := dec.decode(int(r-nodeCount-16), 0)
+					if err != nil {
+						return err
+					}
+					rec = mmdbInterval(val, nameKey)
+					cache[r] = rec
+				}
+				if rec == nil {
+					continue
+				}
+				if err := ipset.addMMDBBlock(*rec, k, depth+1, ipVersion == 4); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if nodeCount == 0 {
+		return nil
+	}
+	return walk(0, Uint128{}, 0)
+}
+
+// mmdbInterval converts a decoded record to an Interval without a
+// range, or nil if the record has no name
+func mmdbInterval(val interface{}, nameKey string) *Interval {
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	str := func(k string) string {
+		s, _ := m[k].(string)
+		return s
+	}
+	rec := &Interval{
+		Name: str(nameKey),
+		URL:  str("url"),
+		Metadata: Metadata{
+			Category: Category(str("category")),
+			Region:   str("region"),
+			Service:  str("service"),
+			Source:   str("source"),
+			Country:  str("country"),
+			City:     str("city"),
+			Postal:   str("postal"),
+		},
+	}
+	if rec.Name == "" {
+		return nil
+	}
+	for _, k := range []string{"asn", "autonomous_system_number"} {
+		if asn, ok := m[k].(uint64); ok && asn <= math.MaxUint32 {
+			rec.ASN = uint32(asn)
+			break
+		}
+	}
+	if t, ok := m["last_seen"].(uint64); ok && t <= math.MaxInt64 {
+		rec.LastSeen = time.Unix(int64(t), 0).UTC()
+	}
+	return rec
+}
+
+// addMMDBBlock adds a network found in a tree, splitting it if it is
+// too large
+func (ipset *IntervalSet) addMMDBBlock(rec Interval, key Uint128, bits int, v4tree bool) error {
+	if v4tree {
+		key = key.rsh(96)
+		bits += mmdbV4Depth
+	}
+	maxBits := 16
+	if key.Hi == 0 && key.Lo>>32 == 0 && bits >= mmdbV4Depth {
+		// IPv4 network
+		key = Uint128FromV4(uint32(key.Lo))
+		maxBits = mmdbV4Depth + 8
+	}
+	if bits < maxBits {
+		for i := uint64(0); i < 1<<uint(maxBits-bits); i++ {
+			sub := key.or(Uint128{Lo: i}.lsh(uint(128 - maxBits)))
+			if err := ipset.addMMDBBlock(rec, sub, maxBits, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	rec.Left = key
+	rec.Right = key.or(Uint128{Hi: math.MaxUint64, Lo: math.MaxUint64}.rsh(uint(bits)))
+	return ipset.AddInterval(rec)
+}
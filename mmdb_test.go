@@ -0,0 +1,209 @@
+package ipcat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+)
+
+// mmdbLookup is a minimal search tree walk following the MaxMind DB
+// spec, used to check ExportMMDB independently of ImportMMDB.  Values
+// are read with mmdbDecoder, their encoding is checked by
+// TestMMDBGolden.
+func mmdbLookup(t *testing.T, data []byte, ip string) map[string]interface{} {
+	start := bytes.LastIndex(data, mmdbMetadataMarker)
+	meta := &mmdbDecoder{buf: data[start+len(mmdbMetadataMarker):]}
+	val, _, err := meta.decode(0, 0)
+	if err != nil {
+		t.Fatalf("decoding metadata: %s", err)
+	}
+	md := val.(map[string]interface{})
+	nodeCount := md["node_count"].(uint64)
+	if md["record_size"].(uint64) != 24 {
+		t.Fatalf("record_size = %v, want 24", md["record_size"])
+	}
+	b := netip.MustParseAddr(ip).As16()
+	if netip.MustParseAddr(ip).Is4() {
+		// IPv4 lives at ::a.b.c.d
+		b = [16]byte{12: b[12], 13: b[13], 14: b[14], 15: b[15]}
+	}
+	node := uint64(0)
+	for i := 0; i < 128 && node < nodeCount; i++ {
+		bit := (b[i/8] >> (7 - uint(i%8))) & 1
+		rec := data[node*6+3*uint64(bit):]
+		node = uint64(rec[0])<<16 | uint64(rec[1])<<8 | uint64(rec[2])
+	}
+	if node == nodeCount {
+		return nil
+	}
+	dec := &mmdbDecoder{buf: data[nodeCount*6+16 : start]}
+	val, _, err = dec.decode(int(node-nodeCount-16), 0)
+	if err != nil {
+		t.Fatalf("decoding record for %s: %s", ip, err)
+	}
+	return val.(map[string]interface{})
+}
+
+func TestMMDBRoundTrip(t *testing.T) {
+	f, err := os.Open("datacenters.csv")
+	if err != nil {
+		t.Fatalf("Unable to open datacenters.csv: %s", err)
+	}
+	defer f.Close()
+	ipset := NewIntervalSet(4096)
+	if err := ipset.ImportCSV(f); err != nil {
+		t.Fatalf("ImportCSV error: %s", err)
+	}
+	ipset.AddCIDRMeta("2600:1f00::/24", "Amazon AWS", "http://www.amazon.com/aws/", Metadata{
+		Category: CategoryCloud,
+		Region:   "us-east-1",
+		ASN:      16509,
+	})
+
+	var buf bytes.Buffer
+	if err := ipset.ExportMMDB(&buf, time.Now()); err != nil {
+		t.Fatalf("ExportMMDB error: %s", err)
+	}
+	data := buf.Bytes()
+
+	for _, tt := range []struct {
+		ip   string
+		want string
+	}{
+		{"3.0.0.1", "Amazon AWS"},
+		{"::ffff:3.0.0.1", "Amazon AWS"},
+		{"2600:1f00::1", "Amazon AWS"},
+		{"127.0.0.1", ""},
+	} {
+		rec := mmdbLookup(t, data, tt.ip)
+		got, _ := rec["name"].(string)
+		if got != tt.want {
+			t.Errorf("MMDB lookup %s = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+	if rec := mmdbLookup(t, data, "2600:1f00::1"); rec["asn"] != uint64(16509) || rec["region"] != "us-east-1" {
+		t.Errorf("MMDB record for 2600:1f00::1 = %v", rec)
+	}
+
+	got := NewIntervalSet(4096)
+	if err := got.ImportMMDB(data, ""); err != nil {
+		t.Fatalf("ImportMMDB error: %s", err)
+	}
+	if err := got.sort(); err != nil {
+		t.Fatalf("sort after ImportMMDB: %s", err)
+	}
+	if got.Len() != ipset.Len() {
+		t.Fatalf("ImportMMDB has %d records, want %d", got.Len(), ipset.Len())
+	}
+	for i := range ipset.btree {
+		want, have := ipset.btree[i], got.btree[i]
+		if want.Left != have.Left || want.Right != have.Right || want.Name != have.Name ||
+			want.URL != have.URL || want.Metadata != have.Metadata {
+			t.Fatalf("record %d = %v, want %v", i, have, want)
+		}
+	}
+}
+
+func TestMMDBGolden(t *testing.T) {
+	ipset := NewIntervalSet(10)
+	ipset.AddCIDRMeta("192.0.2.0/24", "Example", "http://example.com/", Metadata{
+		Category: CategoryCloud,
+		ASN:      64496,
+	})
+	var buf bytes.Buffer
+	if err := ipset.ExportMMDB(&buf, time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("ExportMMDB error: %s", err)
+	}
+	data := buf.Bytes()
+	start := bytes.LastIndex(data, mmdbMetadataMarker)
+	if start == -1 {
+		t.Fatalf("metadata marker not found")
+	}
+
+	// data section separator, then a map of 4 pairs with string keys
+	// and values, and a 2 byte uint32
+	record := "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"\xe4" +
+		"\x44name\x47Example" +
+		"\x43url\x53http://example.com/" +
+		"\x48category\x45cloud" +
+		"\x43asn\xc2\xfb\xf0"
+	if !bytes.HasSuffix(data[:start], []byte(record)) {
+		t.Errorf("data section ends with % x, want % x", data[max(0, start-len(record)):start], record)
+	}
+
+	// a map of 9 pairs.  build_epoch is an extended type uint64 of 4
+	// bytes.
+	meta := []byte("\xe9" +
+		"\x5bbinary_format_major_version\xa1\x02" +
+		"\x5bbinary_format_minor_version\xa0" +
+		"\x4bbuild_epoch\x04\x02\x65\x53\xf1\x00" +
+		"\x4ddatabase_type\x45ipcat" +
+		"\x4bdescription\xe1\x42en\x57ipcat datacenter ranges" +
+		"\x4aip_version\xa1\x06" +
+		"\x49languages\x01\x04\x42en" +
+		"\x4anode_count\xc1\x87" +
+		"\x4brecord_size\xa1\x18")
+	got := data[start+len(mmdbMetadataMarker):]
+	if !bytes.Equal(got, meta) {
+		t.Errorf("metadata = % x, want % x", got, meta)
+	}
+}
+
+func TestMMDBDecodeSizes(t *testing.T) {
+	for _, size := range []int{0, 28, 29, 284, 285, 65820, 65821, 70000} {
+		s := string(bytes.Repeat([]byte("x"), size))
+		enc := appendMMDBString(nil, s)
+		val, next, err := (&mmdbDecoder{buf: enc}).decode(0, 0)
+		if err != nil || val != s || next != len(enc) {
+			t.Errorf("string of length %d did not round trip: %v", size, err)
+		}
+	}
+
+	// pointer to a string
+	enc := appendMMDBString(nil, "hello")
+	ptr := len(enc)
+	enc = append(enc, 0x20, 0x00)
+	val, next, err := (&mmdbDecoder{buf: enc}).decode(ptr, 0)
+	if err != nil || val != "hello" || next != len(enc) {
+		t.Errorf("pointer decode = %v, %d, %v", val, next, err)
+	}
+
+	// extended types
+	enc = appendMMDBUint(nil, mmdbUint64, 1<<40)
+	enc = binary.BigEndian.AppendUint32(append(enc, 0x04, 0x01), 0xffffffff)
+	val, next, err = (&mmdbDecoder{buf: enc}).decode(0, 0)
+	if err != nil || val != uint64(1<<40) {
+		t.Errorf("uint64 decode = %v, %v", val, err)
+	}
+	if val, _, err = (&mmdbDecoder{buf: enc}).decode(next, 0); err != nil || val != int64(-1) {
+		t.Errorf("int32 decode = %v, %v", val, err)
+	}
+}
+
+func TestMMDBImportInvalid(t *testing.T) {
+	// node_count * record_size overflows to a small tree size
+	data := append(make([]byte, 64), mmdbMetadataMarker...)
+	data = appendMMDBMap(data, []string{"ip_version", "node_count", "record_size"},
+		map[string]interface{}{
+			"ip_version":  uint16(6),
+			"node_count":  uint64(1<<59 + 1),
+			"record_size": uint16(32),
+		})
+	if err := NewIntervalSet(10).ImportMMDB(data, ""); err != errMMDB {
+		t.Errorf("ImportMMDB with an overflowing node_count returned %v, want %v", err, errMMDB)
+	}
+
+	// a map and an array claiming more entries than there are bytes
+	for _, enc := range [][]byte{
+		appendControl(nil, mmdbMap, 1<<24),
+		appendControl(nil, mmdbArray, 1<<24),
+	} {
+		if _, _, err := (&mmdbDecoder{buf: enc}).decode(0, 0); err != errMMDB {
+			t.Errorf("decode of % x returned %v, want %v", enc, err, errMMDB)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+var (
+	mullvadDownload = "https://api.mullvad.net/www/relays/all/"
+)
+
+const (
+	mullvadName = "Mullvad VPN"
+	mullvadURL  = "https://mullvad.net/"
+)
+
+func init() {
+	RegisterLayer("mullvad", MullvadProvider{})
+}
+
+// MullvadProvider is the Provider for the Mullvad VPN servers
+type MullvadProvider struct{}
+
+// Name satisfies the Provider interface
+func (MullvadProvider) Name() string { return mullvadName }
+
+// URL satisfies the Provider interface
+func (MullvadProvider) URL() string { return mullvadURL }
+
+// Fetch satisfies the Provider interface
+func (MullvadProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, mullvadDownload)
+}
+
+// Update satisfies the Provider interface
+func (MullvadProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateMullvad(ipmap, body)
+}
+
+// MullvadRelay is a server in the Mullvad relay list
+type MullvadRelay struct {
+	Hostname    string `json:"hostname"`
+	CountryCode string `json:"country_code"`
+	CityName    string `json:"city_name"`
+	Active      bool   `json:"active"`
+	Type        string `json:"type"`
+	IPv4AddrIn  string `json:"ipv4_addr_in"`
+	IPv6AddrIn  string `json:"ipv6_addr_in"`
+}
+
+// DownloadMullvad downloads the latest Mullvad relay list
+func DownloadMullvad() ([]byte, error) {
+	return MullvadProvider{}.Fetch(context.Background(), nil)
+}
+
+// UpdateMullvad parses the Mullvad relay list and updates the interval
+// set with the addresses of the active WireGuard and OpenVPN servers.
+// Mullvad does not publish exit addresses separately, the servers'
+// own addresses are used.  Bridges only carry traffic into the
+// network and are skipped.
+func UpdateMullvad(ipmap *IntervalSet, body []byte) error {
+	var relays []MullvadRelay
+	err := json.Unmarshal(body, &relays)
+	if err != nil {
+		return err
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(mullvadName)
+
+	// and add back
+	for _, relay := range relays {
+		if !relay.Active || relay.Type == "bridge" {
+			continue
+		}
+		for _, s := range []string{relay.IPv4AddrIn, relay.IPv6AddrIn} {
+			if s == "" {
+				continue
+			}
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return fmt.Errorf("Invalid address %q for %s", s, relay.Hostname)
+			}
+			err = ipmap.AddPrefixMeta(netip.PrefixFrom(addr, addr.BitLen()), mullvadName, mullvadURL, Metadata{
+				Category: CategoryVPN,
+				Service:  relay.Type,
+				Source:   "mullvad",
+				Country:  strings.ToUpper(relay.CountryCode),
+				City:     relay.CityName,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package ipcat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMullvad(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	setHook(t, &mullvadDownload, ts.URL+"/mullvad.json")
+
+	b, err := DownloadMullvad()
+	if err != nil {
+		t.Fatalf("DownloadMullvad() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	err = UpdateMullvad(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateMullvad error: %v", err)
+	}
+	if n := ipset.Len(); n != 4 {
+		t.Errorf("UpdateMullvad added %d records, want 4", n)
+	}
+
+	for _, tt := range []struct {
+		ip      string
+		service string
+		country string
+	}{
+		{"31.171.153.66", "wireguard", "AL"},
+		{"2a04:27c0:0:3::a01f", "wireguard", "AL"},
+		{"146.70.116.98", "openvpn", "AT"},
+		{"146.70.116.130", "", ""},
+		{"103.214.20.50", "", ""},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if tt.service == "" {
+			if rec != nil {
+				t.Errorf("ipset.Contains(%q) = %v, want nil", tt.ip, rec)
+			}
+			continue
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Category != CategoryVPN || rec.Service != tt.service || rec.Country != tt.country {
+			t.Errorf("ipset.Contains(%q) = %q %q %q, want %q %q %q", tt.ip,
+				rec.Category, rec.Service, rec.Country, CategoryVPN, tt.service, tt.country)
+		}
+	}
+}
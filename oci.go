@@ -0,0 +1,112 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+)
+
+var (
+	ociDownload = "https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json"
+)
+
+const (
+	ociName = "Oracle Cloud"
+	ociURL  = "https://www.oracle.com/cloud/"
+)
+
+func init() {
+	Register("oci", OCIProvider{})
+}
+
+// OCIProvider is the Provider for Oracle Cloud Infrastructure
+type OCIProvider struct{}
+
+// Name satisfies the Provider interface
+func (OCIProvider) Name() string { return ociName }
+
+// URL satisfies the Provider interface
+func (OCIProvider) URL() string { return ociURL }
+
+// Fetch satisfies the Provider interface
+func (OCIProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, ociDownload)
+}
+
+// Update satisfies the Provider interface
+func (OCIProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateOCI(ipmap, body)
+}
+
+// OCICIDR is a range in the OCI public IP ranges file, with tags
+// such as "OCI", "OSN" or "OBJECT_STORAGE"
+type OCICIDR struct {
+	CIDR string   `json:"cidr"`
+	Tags []string `json:"tags"`
+}
+
+// OCIRegion is a region in the OCI public IP ranges file
+type OCIRegion struct {
+	Region string    `json:"region"`
+	CIDRs  []OCICIDR `json:"cidrs"`
+}
+
+// OCI is the main record of the OCI public IP ranges file
+type OCI struct {
+	LastUpdated string      `json:"last_updated_timestamp"`
+	Regions     []OCIRegion `json:"regions"`
+}
+
+// DownloadOCI downloads the latest OCI public IP ranges list
+func DownloadOCI() ([]byte, error) {
+	return OCIProvider{}.Fetch(context.Background(), nil)
+}
+
+// ociTagRank orders tags when a range has several.  OSN, the Oracle
+// Services Network, includes Object Storage, and OCI is the default.
+func ociTagRank(tag string) int {
+	switch tag {
+	case "OCI":
+		return 0
+	case "OSN":
+		return 1
+	}
+	return 2
+}
+
+// UpdateOCI parses the OCI public IP ranges file and updates the
+// interval set.  Each range is tagged with its region and its most
+// specific tag as the service.
+func UpdateOCI(ipmap *IntervalSet, body []byte) error {
+	oci := OCI{}
+	err := json.Unmarshal(body, &oci)
+	if err != nil {
+		return err
+	}
+
+	tmp := NewIntervalSet(100)
+	for _, region := range oci.Regions {
+		for _, rec := range region.CIDRs {
+			service := ""
+			for _, tag := range rec.Tags {
+				if service == "" || ociTagRank(tag) > ociTagRank(service) {
+					service = tag
+				}
+			}
+			err = tmp.AddCIDRMeta(rec.CIDR, ociName, ociURL, Metadata{
+				Category: CategoryCloud,
+				Region:   region.Region,
+				Service:  service,
+				Source:   "oci",
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(ociName)
+
+	// and add back
+	return addResolved(ipmap, tmp)
+}
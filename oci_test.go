@@ -0,0 +1,52 @@
+package ipcat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOCI(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	setHook(t, &ociDownload, ts.URL+"/oci.json")
+
+	b, err := DownloadOCI()
+	if err != nil {
+		t.Fatalf("DownloadOCI() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	ipset.AddCIDR("130.61.0.0/24", ociName, ociURL)
+	err = UpdateOCI(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateOCI error: %v", err)
+	}
+	if n := ipset.Len(); n != 5 {
+		t.Errorf("UpdateOCI added %d records, want 5", n)
+	}
+
+	for _, tt := range []struct {
+		ip      string
+		region  string
+		service string
+	}{
+		{"129.146.1.1", "us-phoenix-1", "OCI"},
+		{"134.70.8.1", "us-phoenix-1", "OBJECT_STORAGE"},
+		{"147.154.1.1", "us-phoenix-1", "OSN"},
+		{"130.61.0.1", "eu-frankfurt-1", "OCI"},
+		{"134.70.24.1", "eu-frankfurt-1", "OBJECT_STORAGE"},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Name != ociName || rec.Region != tt.region || rec.Service != tt.service {
+			t.Errorf("ipset.Contains(%q) = %q %q %q, want %q %q %q", tt.ip,
+				rec.Name, rec.Region, rec.Service, ociName, tt.region, tt.service)
+		}
+	}
+}
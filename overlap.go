@@ -0,0 +1,218 @@
+package ipcat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OverlapPolicy determines what happens when two intervals in a set
+// intersect
+type OverlapPolicy int
+
+const (
+	// OverlapReject fails the sort with an error.  This is the default.
+	OverlapReject OverlapPolicy = iota
+
+	// OverlapMostSpecific gives the overlapping addresses to the
+	// smaller interval and keeps the rest of the larger one as
+	// non-overlapping fragments.  It suits provider ranges that nest
+	// inside others, such as GitHub Actions or Bingbot inside
+	// Microsoft Azure.  Equal intervals go to the higher source
+	// priority, see SetSourcePriority, then to the one added first.
+	OverlapMostSpecific
+
+	// OverlapFirstSource keeps the interval that was added first and
+	// drops the later one
+	OverlapFirstSource
+
+	// OverlapPriority keeps the interval whose source has the highest
+	// priority, see SetSourcePriority.  Ties go to the interval added
+	// first.
+	OverlapPriority
+)
+
+var overlapPolicyNames = []string{
+	OverlapReject:       "reject",
+	OverlapMostSpecific: "most-specific",
+	OverlapFirstSource:  "first-source",
+	OverlapPriority:     "priority",
+}
+
+// String returns the name of the policy as accepted by
+// ParseOverlapPolicy
+func (p OverlapPolicy) String() string {
+	if p < 0 || int(p) >= len(overlapPolicyNames) {
+		return fmt.Sprintf("OverlapPolicy(%d)", int(p))
+	}
+	return overlapPolicyNames[p]
+}
+
+// ParseOverlapPolicy converts a policy name such as "most-specific"
+// to an OverlapPolicy
+func ParseOverlapPolicy(name string) (OverlapPolicy, error) {
+	for i, n := range overlapPolicyNames {
+		if strings.EqualFold(n, name) {
+			return OverlapPolicy(i), nil
+		}
+	}
+	return OverlapReject, fmt.Errorf("Unknown overlap policy %q", name)
+}
+
+// Overlap is a report of one interval that lost to others during
+// overlap resolution
+type Overlap struct {
+	Loser     Interval
+	Winners   []Interval
+	Fragments []Interval
+}
+
+// String satisfies the fmt.Stringer interface
+func (o Overlap) String() string {
+	names := make([]string, 0, len(o.Winners))
+	for _, w := range o.Winners {
+		names = append(names, fmt.Sprintf("%s [%s,%s]", w.Name, w.Left, w.Right))
+	}
+	action := "dropped"
+	if len(o.Fragments) > 0 {
+		action = fmt.Sprintf("split into %d fragments", len(o.Fragments))
+	}
+	return fmt.Sprintf("%s [%s,%s] %s in favor of %s",
+		o.Loser.Name, o.Loser.Left, o.Loser.Right, action, strings.Join(names, ", "))
+}
+
+// SetOverlapPolicy sets how intersecting intervals are handled the
+// next time the set is sorted
+func (ipset *IntervalSet) SetOverlapPolicy(p OverlapPolicy) {
+	ipset.policy = p
+	ipset.sorted = false
+}
+
+// SetSourcePriority sets the priorities used by OverlapPriority, and
+// for equal intervals by OverlapMostSpecific.  Keys
+// are matched against Interval.Source, or Interval.Name if the source
+// is empty.  Higher values win, unknown sources have priority 0.
+func (ipset *IntervalSet) SetSourcePriority(priority map[string]int) {
+	ipset.priority = priority
+	ipset.sorted = false
+}
+
+// Resolve sorts the set, applying the overlap policy, and returns a
+// report of every overlap resolved by that sort
+func (ipset *IntervalSet) Resolve() ([]Overlap, error) {
+	if err := ipset.sort(); err != nil {
+		return nil, err
+	}
+	return ipset.overlaps, nil
+}
+
+// sourcePriority returns the priority of an interval's source
+func (ipset *IntervalSet) sourcePriority(rec *Interval) int {
+	if rec.Source != "" {
+		if p, ok := ipset.priority[rec.Source]; ok {
+			return p
+		}
+	}
+	return ipset.priority[rec.Name]
+}
+
+// resolve takes a cluster of chained overlapping intervals and returns
+// a sorted non-overlapping replacement according to the policy
+func (ipset *IntervalSet) resolve(cluster []Interval) []Interval {
+	ranked := make([]Interval, len(cluster))
+	copy(ranked, cluster)
+	bySize := func(i, j int) bool {
+		si := ranked[i].Right.sub(ranked[i].Left)
+		sj := ranked[j].Right.sub(ranked[j].Left)
+		if si != sj {
+			return si.Less(sj)
+		}
+		pi, pj := ipset.sourcePriority(&ranked[i]), ipset.sourcePriority(&ranked[j])
+		if pi != pj {
+			return pi > pj
+		}
+		return ranked[i].seq < ranked[j].seq
+	}
+	switch ipset.policy {
+	case OverlapMostSpecific:
+		sort.Slice(ranked, bySize)
+	case OverlapFirstSource:
+		sort.Slice(ranked, func(i, j int) bool {
+			return ranked[i].seq < ranked[j].seq
+		})
+	case OverlapPriority:
+		sort.Slice(ranked, func(i, j int) bool {
+			pi, pj := ipset.sourcePriority(&ranked[i]), ipset.sourcePriority(&ranked[j])
+			if pi != pj {
+				return pi > pj
+			}
+			return ranked[i].seq < ranked[j].seq
+		})
+	}
+
+	// accepted is kept sorted by Left and never overlaps itself
+	accepted := make(intervallist, 0, len(ranked))
+	for _, cand := range ranked {
+		first := sort.Search(len(accepted), func(i int) bool {
+			return !accepted[i].Right.Less(cand.Left)
+		})
+		last := first
+		for last < len(accepted) && !cand.Right.Less(accepted[last].Left) {
+			last++
+		}
+		if first == last {
+			accepted = accepted.insert(first, cand)
+			continue
+		}
+		report := Overlap{
+			Loser:   cand,
+			Winners: append([]Interval(nil), accepted[first:last]...),
+		}
+		if ipset.policy == OverlapMostSpecific {
+			report.Fragments = gaps(cand, report.Winners)
+			for _, frag := range report.Fragments {
+				pos := sort.Search(len(accepted), func(i int) bool {
+					return frag.Left.Less(accepted[i].Left)
+				})
+				accepted = accepted.insert(pos, frag)
+			}
+		}
+		ipset.overlaps = append(ipset.overlaps, report)
+	}
+	return accepted
+}
+
+// insert adds rec at position pos
+func (ipset intervallist) insert(pos int, rec Interval) intervallist {
+	ipset = append(ipset, Interval{})
+	copy(ipset[pos+1:], ipset[pos:])
+	ipset[pos] = rec
+	return ipset
+}
+
+// gaps returns the parts of rec not covered by the sorted list of
+// intervals in cover
+func gaps(rec Interval, cover []Interval) []Interval {
+	var out []Interval
+	next := rec.Left
+	for _, c := range cover {
+		if next.Less(c.Left) {
+			frag := rec
+			frag.Left = next
+			frag.Right = c.Left.sub(Uint128{Lo: 1})
+			if rec.Right.Less(frag.Right) {
+				frag.Right = rec.Right
+			}
+			out = append(out, frag)
+		}
+		if !c.Right.Less(rec.Right) {
+			return out
+		}
+		if next.Less(c.Right.add1()) {
+			next = c.Right.add1()
+		}
+	}
+	frag := rec
+	frag.Left = next
+	return append(out, frag)
+}
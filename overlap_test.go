@@ -0,0 +1,90 @@
+package ipcat
+
+import "testing"
+
+func TestOverlapPolicies(t *testing.T) {
+	tests := []struct {
+		policy    OverlapPolicy
+		priority  map[string]int
+		want      map[string]string
+		fragments int
+	}{
+		{
+			policy:    OverlapMostSpecific,
+			want:      map[string]string{"10.0.1.1": "Upstream", "10.0.5.1": "Reseller", "10.0.6.1": "Upstream", "10.0.255.1": "Upstream"},
+			fragments: 2,
+		},
+		{
+			policy: OverlapFirstSource,
+			want:   map[string]string{"10.0.1.1": "Upstream", "10.0.5.1": "Upstream", "10.0.6.1": "Upstream"},
+		},
+		{
+			policy:   OverlapPriority,
+			priority: map[string]int{"aws": 10},
+			want:     map[string]string{"10.0.1.1": "", "10.0.5.1": "Reseller", "10.0.6.1": ""},
+		},
+		{
+			policy:   OverlapPriority,
+			priority: map[string]int{"Upstream": 10},
+			want:     map[string]string{"10.0.1.1": "Upstream", "10.0.5.1": "Upstream", "10.0.6.1": "Upstream"},
+		},
+	}
+	for _, tt := range tests {
+		ipset := NewIntervalSet(10)
+		ipset.SetOverlapPolicy(tt.policy)
+		ipset.SetSourcePriority(tt.priority)
+		ipset.AddCIDR("10.0.0.0/16", "Upstream", "")
+		ipset.AddCIDRMeta("10.0.5.0/24", "Reseller", "", Metadata{Source: "aws"})
+		ipset.AddCIDR("192.168.0.0/24", "Unrelated", "")
+
+		report, err := ipset.Resolve()
+		if err != nil {
+			t.Fatalf("%s: Resolve() error: %s", tt.policy, err)
+		}
+		if len(report) != 1 {
+			t.Fatalf("%s: Resolve() reported %d overlaps, want 1", tt.policy, len(report))
+		}
+		if got := len(report[0].Fragments); got != tt.fragments {
+			t.Errorf("%s: got %d fragments, want %d", tt.policy, got, tt.fragments)
+		}
+		for ip, want := range tt.want {
+			rec, err := ipset.Contains(ip)
+			if err != nil {
+				t.Fatalf("%s: Contains(%q) error: %s", tt.policy, ip, err)
+			}
+			got := ""
+			if rec != nil {
+				got = rec.Name
+			}
+			if got != want {
+				t.Errorf("%s: Contains(%q) = %q, want %q", tt.policy, ip, got, want)
+			}
+		}
+	}
+}
+
+func TestOverlapReject(t *testing.T) {
+	ipset := NewIntervalSet(10)
+	ipset.AddCIDR("10.0.0.0/16", "Upstream", "")
+	ipset.AddCIDR("10.0.5.0/24", "Reseller", "")
+	_, err := ipset.Resolve()
+	if err == nil {
+		t.Fatalf("Resolve() allowed overlapping regions with OverlapReject")
+	}
+	want := "Overlapping regions Upstream [10.0.0.0,10.0.255.255] vs. Reseller [10.0.5.0,10.0.5.255]"
+	if err.Error() != want {
+		t.Errorf("Resolve() error %q, want %q", err, want)
+	}
+}
+
+func TestParseOverlapPolicy(t *testing.T) {
+	for _, p := range []OverlapPolicy{OverlapReject, OverlapMostSpecific, OverlapFirstSource, OverlapPriority} {
+		got, err := ParseOverlapPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseOverlapPolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseOverlapPolicy("bogus"); err == nil {
+		t.Errorf("ParseOverlapPolicy(%q) did not return an error", "bogus")
+	}
+}
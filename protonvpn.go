@@ -0,0 +1,116 @@
+package ipcat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+var (
+	protonVPNDownload = "https://api.protonvpn.ch/vpn/logicals"
+)
+
+const (
+	protonVPNName = "Proton VPN"
+	protonVPNURL  = "https://protonvpn.com/"
+)
+
+func init() {
+	RegisterLayer("protonvpn", ProtonVPNProvider{})
+}
+
+// ProtonVPNProvider is the Provider for the Proton VPN servers
+type ProtonVPNProvider struct{}
+
+// Name satisfies the Provider interface
+func (ProtonVPNProvider) Name() string { return protonVPNName }
+
+// URL satisfies the Provider interface
+func (ProtonVPNProvider) URL() string { return protonVPNURL }
+
+// Fetch satisfies the Provider interface
+func (ProtonVPNProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, protonVPNDownload)
+}
+
+// Update satisfies the Provider interface
+func (ProtonVPNProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateProtonVPN(ipmap, body)
+}
+
+// ProtonVPNServer is a physical server of a logical server
+type ProtonVPNServer struct {
+	EntryIP string `json:"EntryIP"`
+	ExitIP  string `json:"ExitIP"`
+	Domain  string `json:"Domain"`
+	Status  int    `json:"Status"`
+}
+
+// ProtonVPNLogical is a logical server, such as "CH#1", in the Proton
+// VPN server list.  A Status of 1 means online.
+type ProtonVPNLogical struct {
+	Name         string            `json:"Name"`
+	EntryCountry string            `json:"EntryCountry"`
+	ExitCountry  string            `json:"ExitCountry"`
+	City         string            `json:"City"`
+	Status       int               `json:"Status"`
+	Servers      []ProtonVPNServer `json:"Servers"`
+}
+
+// ProtonVPNLogicals is the main record of the Proton VPN server list
+type ProtonVPNLogicals struct {
+	LogicalServers []ProtonVPNLogical `json:"LogicalServers"`
+}
+
+// DownloadProtonVPN downloads the latest Proton VPN server list
+func DownloadProtonVPN() ([]byte, error) {
+	return ProtonVPNProvider{}.Fetch(context.Background(), nil)
+}
+
+// UpdateProtonVPN parses the Proton VPN server list and updates the
+// interval set with the exit addresses of the online servers.  Several
+// logical servers share physical servers, the first one listed gives
+// the country and city.
+func UpdateProtonVPN(ipmap *IntervalSet, body []byte) error {
+	list := ProtonVPNLogicals{}
+	err := json.Unmarshal(body, &list)
+	if err != nil {
+		return err
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(protonVPNName)
+
+	// and add back
+	seen := make(map[netip.Addr]bool)
+	for _, logical := range list.LogicalServers {
+		if logical.Status != 1 {
+			continue
+		}
+		for _, server := range logical.Servers {
+			if server.Status != 1 || server.ExitIP == "" {
+				continue
+			}
+			addr, err := netip.ParseAddr(server.ExitIP)
+			if err != nil {
+				return fmt.Errorf("Invalid address %q for %s", server.ExitIP, logical.Name)
+			}
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			err = ipmap.AddPrefixMeta(netip.PrefixFrom(addr, addr.BitLen()), protonVPNName, protonVPNURL, Metadata{
+				Category: CategoryVPN,
+				Source:   "protonvpn",
+				Country:  strings.ToUpper(logical.ExitCountry),
+				City:     logical.City,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
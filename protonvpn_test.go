@@ -0,0 +1,57 @@
+package ipcat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtonVPN(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	setHook(t, &protonVPNDownload, ts.URL+"/protonvpn.json")
+
+	b, err := DownloadProtonVPN()
+	if err != nil {
+		t.Fatalf("DownloadProtonVPN() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	err = UpdateProtonVPN(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateProtonVPN error: %v", err)
+	}
+	if n := ipset.Len(); n != 2 {
+		t.Errorf("UpdateProtonVPN added %d records, want 2", n)
+	}
+
+	for _, tt := range []struct {
+		ip      string
+		country string
+		city    string
+	}{
+		{"185.159.157.11", "CH", "Zurich"},
+		{"194.126.177.14", "DE", "Frankfurt"},
+		{"185.159.157.10", "", ""},
+		{"185.159.157.21", "", ""},
+		{"190.2.131.151", "", ""},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if tt.country == "" {
+			if rec != nil {
+				t.Errorf("ipset.Contains(%q) = %v, want nil", tt.ip, rec)
+			}
+			continue
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Category != CategoryVPN || rec.Country != tt.country || rec.City != tt.city {
+			t.Errorf("ipset.Contains(%q) = %q %q %q, want %q %q %q", tt.ip,
+				rec.Category, rec.Country, rec.City, CategoryVPN, tt.country, tt.city)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package ipcat
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider is a source of IP ranges that can be downloaded and merged
+// into an IntervalSet
+type Provider interface {
+	// Name returns the name used for the provider's records
+	Name() string
+
+	// URL returns the provider's home page
+	URL() string
+
+	// Fetch downloads the raw range data with the Fetcher, which may
+	// be nil for DefaultFetcher
+	Fetch(ctx context.Context, f *Fetcher) ([]byte, error)
+
+	// Update parses raw range data and replaces the provider's
+	// records in the set
+	Update(ipmap *IntervalSet, body []byte) error
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Provider)
+	layers      = make(map[string]bool)
+)
+
+// Register makes a provider available under a short key such as
+// "aws".  It panics if the key is already registered.
+func Register(key string, p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if p == nil {
+		panic("ipcat: Register provider is nil")
+	}
+	if _, dup := providers[key]; dup {
+		panic("ipcat: Register called twice for provider " + key)
+	}
+	providers[key] = p
+}
+
+// RegisterLayer is Register for a provider of short-lived ranges, such
+// as Tor exits, that are kept in a layer file rather than with the
+// hosting ranges.  It is left out of "all" by ParseProviderList.
+func RegisterLayer(key string, p Provider) {
+	Register(key, p)
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	layers[key] = true
+}
+
+// LookupProvider returns the provider registered under key
+func LookupProvider(key string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[key]
+	return p, ok
+}
+
+// ProviderKeys returns the sorted keys of all registered providers
+func ProviderKeys() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	keys := make([]string, 0, len(providers))
+	for k := range providers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LayerKeys returns the sorted keys of the providers registered with
+// RegisterLayer
+func LayerKeys() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	keys := make([]string, 0, len(layers))
+	for k := range layers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseProviderList converts a comma separated list of provider keys,
+// or "all" for every provider not registered with RegisterLayer, to
+// providers
+func ParseProviderList(list string) ([]Provider, error) {
+	keys := strings.Split(list, ",")
+	if strings.TrimSpace(list) == "all" {
+		keys = nil
+		for _, k := range ProviderKeys() {
+			if !slices.Contains(LayerKeys(), k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	out := make([]Provider, 0, len(keys))
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		p, ok := LookupProvider(k)
+		if !ok {
+			return nil, fmt.Errorf("Unknown provider %q, known providers: %s",
+				k, strings.Join(ProviderKeys(), ", "))
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// UpdateProvider downloads a provider's ranges with the Fetcher, which
+// may be nil for DefaultFetcher, and updates the set
+func UpdateProvider(ctx context.Context, f *Fetcher, ipmap *IntervalSet, p Provider) error {
+	body, err := p.Fetch(ctx, f)
+	if err != nil {
+		return fmt.Errorf("Unable to download %s ranges: %s", p.Name(), err)
+	}
+	if err := p.Update(ipmap, body); err != nil {
+		return fmt.Errorf("Unable to parse %s ranges: %s", p.Name(), err)
+	}
+	return nil
+}
+
+// addResolved adds the records of tmp to ipmap after splitting any
+// overlaps within tmp in favor of the most specific range.  Providers
+// use it when their own data nests.
+func addResolved(ipmap *IntervalSet, tmp *IntervalSet) error {
+	tmp.SetOverlapPolicy(OverlapMostSpecific)
+	if err := tmp.sort(); err != nil {
+		return err
+	}
+	for _, rec := range tmp.btree {
+		if err := ipmap.AddInterval(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package ipcat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProviders drives every registered provider with its fixture in
+// testdata/<key>.*
+func TestProviders(t *testing.T) {
+	keys := ProviderKeys()
+	if len(keys) == 0 {
+		t.Fatal("no providers registered")
+	}
+	for _, key := range keys {
+		p, ok := LookupProvider(key)
+		if !ok {
+			t.Fatalf("LookupProvider(%q) failed", key)
+		}
+		files, _ := filepath.Glob(filepath.Join("testdata", key+".*"))
+		if len(files) != 1 {
+			t.Errorf("%s: want exactly one fixture testdata/%s.*, got %v", key, key, files)
+			continue
+		}
+		body, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ipset := NewIntervalSet(100)
+		if err := p.Update(ipset, body); err != nil {
+			t.Errorf("%s: Update error: %s", key, err)
+			continue
+		}
+		if _, err := ipset.Resolve(); err != nil {
+			t.Errorf("%s: Update: %s", key, err)
+		}
+		n := ipset.Len()
+		if n == 0 {
+			t.Errorf("%s: Update added no records", key)
+		}
+		for rec := range ipset.All() {
+			if rec.Name != p.Name() {
+				t.Errorf("%s: record name %q, want %q", key, rec.Name, p.Name())
+			}
+		}
+
+		// updating again must replace, not duplicate, the records
+		if err := p.Update(ipset, body); err != nil {
+			t.Errorf("%s: second Update error: %s", key, err)
+		}
+		if _, err := ipset.Resolve(); err != nil {
+			t.Errorf("%s: second Update: %s", key, err)
+		}
+		if ipset.Len() != n {
+			t.Errorf("%s: second Update has %d records, want %d", key, ipset.Len(), n)
+		}
+	}
+}
+
+// TestProvidersMerge updates datacenters.csv with the fixtures of the
+// providers of "make update-all".  Where their ranges nest, only
+// records of the updated providers may be split, never the rows
+// maintained by hand, and GitHub wins the ranges it shares with
+// Azure.
+func TestProvidersMerge(t *testing.T) {
+	f, err := os.Open("datacenters.csv")
+	if err != nil {
+		t.Fatalf("Unable to open datacenters.csv: %s", err)
+	}
+	defer f.Close()
+	ipset := NewIntervalSet(4096)
+	if err := ipset.ImportCSV(f); err != nil {
+		t.Fatalf("ImportCSV error: %s", err)
+	}
+	ipset.SetOverlapPolicy(OverlapMostSpecific)
+	ipset.SetSourcePriority(map[string]int{"github": 1})
+
+	keys := "aws,azure,cloudflare,google,oci,digitalocean,linode,vultr,github,fastly,bunnycdn"
+	updated := make(map[string]bool)
+	for _, key := range strings.Split(keys, ",") {
+		p, _ := LookupProvider(key)
+		files, _ := filepath.Glob(filepath.Join("testdata", key+".*"))
+		if len(files) != 1 {
+			t.Fatalf("%s: want exactly one fixture, got %v", key, files)
+		}
+		if err := p.Update(ipset, mustReadFile(t, files[0])); err != nil {
+			t.Fatalf("%s: Update error: %s", key, err)
+		}
+		updated[p.Name()] = true
+	}
+	overlaps, err := ipset.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve() error: %s", err)
+	}
+	for _, o := range overlaps {
+		if !updated[o.Loser.Name] {
+			t.Errorf("hand maintained row changed: %s", o)
+		}
+	}
+	if rec, err := ipset.Contains("13.64.1.1"); err != nil || rec == nil || rec.Name != githubName {
+		t.Errorf("Contains(%q) = %v, %v, want %s", "13.64.1.1", rec, err, githubName)
+	}
+}
+
+// TestLayersMerge updates empty layers.csv and relay.csv files with
+// the fixtures of the short-lived providers of "make update-all",
+// which must not overlap one another
+func TestLayersMerge(t *testing.T) {
+	for file, keys := range map[string]string{
+		"layers.csv": "googlebot,bingbot,applebot,tor,mullvad,protonvpn",
+		"relay.csv":  "icloudrelay",
+	} {
+		ipset := NewIntervalSet(100)
+		for _, key := range strings.Split(keys, ",") {
+			p, _ := LookupProvider(key)
+			files, _ := filepath.Glob(filepath.Join("testdata", key+".*"))
+			if len(files) != 1 {
+				t.Fatalf("%s: want exactly one fixture, got %v", key, files)
+			}
+			if err := p.Update(ipset, mustReadFile(t, files[0])); err != nil {
+				t.Fatalf("%s: Update error: %s", key, err)
+			}
+		}
+		if _, err := ipset.Resolve(); err != nil {
+			t.Errorf("%s: Resolve() error: %s", file, err)
+		}
+	}
+}
+
+func TestParseProviderList(t *testing.T) {
+	all, err := ParseProviderList("all")
+	if err != nil {
+		t.Fatalf("ParseProviderList(all) error: %s", err)
+	}
+	if want := len(ProviderKeys()) - len(LayerKeys()); len(all) != want {
+		t.Errorf("ParseProviderList(all) returned %d providers, want %d", len(all), want)
+	}
+	for _, p := range all {
+		if p.Name() == torName {
+			t.Errorf("ParseProviderList(all) returned the layer provider %s", p.Name())
+		}
+	}
+	list, err := ParseProviderList("aws, azure")
+	if err != nil {
+		t.Fatalf("ParseProviderList error: %s", err)
+	}
+	if len(list) != 2 || list[0].Name() != awsName || list[1].Name() != azureName {
+		t.Errorf("ParseProviderList(%q) = %v", "aws, azure", list)
+	}
+	if _, err := ParseProviderList("aws,bogus"); err == nil {
+		t.Errorf("ParseProviderList accepted an unknown provider")
+	}
+}
+
+// setHook sets a package level download hook for the rest of a test
+func setHook[T any](t *testing.T, hook *T, val T) {
+	saved := *hook
+	t.Cleanup(func() { *hook = saved })
+	*hook = val
+}
+
+func mustReadFile(t *testing.T, filename string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,385 @@
+package ipcat
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Offline discovery of hosting ranges in Regional Internet Registry
+// bulk data: RPSL database dumps with inetnum, inet6num, route, route6
+// and organisation objects, as published by RIPE, APNIC, AFRINIC and
+// LACNIC, and the delegated-*-extended statistics files of all five
+// registries.  Matching records are proposed as candidates for review,
+// they are never added to datacenters.csv directly.
+
+// RIRRule maps registry records to a provider.  A record matches if
+// its netname, descr or organisation name contains one of the
+// keywords, ignoring case, or if it is originated or held by one of
+// the ASNs.
+type RIRRule struct {
+	Name     string
+	URL      string
+	Keywords []string
+	ASNs     []uint32
+}
+
+// ParseRIRRules reads rules, one per line, in the form
+//
+//	name,url,keyword or ASN,...
+//
+// such as "Hetzner Online,https://www.hetzner.com/,hetzner,AS24940".
+// Lines starting with # are comments.
+func ParseRIRRules(in io.Reader) ([]RIRRule, error) {
+	r := csv.NewReader(in)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	var rules []RIRRule
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected name,url,keyword... but got %v", line, record)
+		}
+		rule := RIRRule{Name: record[0], URL: record[1]}
+		for _, m := range record[2:] {
+			m = strings.TrimSpace(m)
+			if m == "" {
+				continue
+			}
+			if len(m) > 2 && strings.EqualFold(m[:2], "AS") && m[2] >= '0' && m[2] <= '9' {
+				asn, err := parseASN(m)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", line, err)
+				}
+				rule.ASNs = append(rule.ASNs, asn)
+				continue
+			}
+			rule.Keywords = append(rule.Keywords, strings.ToLower(m))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// RIRScanner collects candidate ranges from registry bulk data.  Data
+// is streamed, so organisation objects must be read before the objects
+// referring to them, and in delegated files the asn records before the
+// address records, which is the order they are published in.
+type RIRScanner struct {
+	rules      []RIRRule
+	candidates *IntervalSet
+
+	// orgs maps matching organisation handles to rules
+	orgs map[string]int
+
+	// holders maps delegated opaque-ids holding a matching ASN to rules
+	holders map[string]int
+
+	// Skipped counts matching records that could not be added, such
+	// as ranges larger than an IPv4 /8
+	Skipped int
+}
+
+// NewRIRScanner returns a scanner for the rules
+func NewRIRScanner(rules []RIRRule) *RIRScanner {
+	return &RIRScanner{
+		rules:      rules,
+		candidates: NewIntervalSet(1000),
+		orgs:       make(map[string]int),
+		holders:    make(map[string]int),
+	}
+}
+
+// matchKeyword returns the first rule with a keyword in one of the
+// values, or -1
+func (s *RIRScanner) matchKeyword(values ...string) int {
+	for i, rule := range s.rules {
+		for _, v := range values {
+			v = strings.ToLower(v)
+			for _, kw := range rule.Keywords {
+				if strings.Contains(v, kw) {
+					return i
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// matchASN returns the first rule with an ASN in [first, first+count),
+// or -1
+func (s *RIRScanner) matchASN(first, count uint64) int {
+	for i, rule := range s.rules {
+		for _, asn := range rule.ASNs {
+			if uint64(asn) >= first && uint64(asn) < first+count {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// add records a candidate range for a rule
+func (s *RIRScanner) add(rule int, left, right netip.Addr, meta Metadata) {
+	err := s.candidates.AddInterval(Interval{
+		Left:     Uint128FromAddr(left),
+		Right:    Uint128FromAddr(right),
+		Name:     s.rules[rule].Name,
+		URL:      s.rules[rule].URL,
+		Metadata: meta,
+	})
+	if err != nil {
+		s.Skipped++
+	}
+}
+
+// rpslObject is an RPSL object, with attribute names in lower case.
+// Repeated attributes are joined with a space.
+type rpslObject struct {
+	class string
+	key   string
+	attrs map[string]string
+}
+
+// readRPSL calls fn for each object of an RPSL database dump
+func readRPSL(in io.Reader, fn func(rpslObject)) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	obj := rpslObject{}
+	last := ""
+	flush := func() {
+		if obj.class != "" {
+			fn(obj)
+		}
+		obj = rpslObject{}
+		last = ""
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case line[0] == '#' || line[0] == '%':
+			// comment
+		case line[0] == ' ' || line[0] == '\t' || line[0] == '+':
+			// continuation of the previous attribute
+			if last != "" {
+				obj.attrs[last] += " " + strings.TrimSpace(line[1:])
+			}
+		default:
+			i := strings.IndexByte(line, ':')
+			if i == -1 {
+				continue
+			}
+			name := strings.ToLower(strings.TrimSpace(line[:i]))
+			val := strings.TrimSpace(line[i+1:])
+			if obj.class == "" {
+				obj.class, obj.key = name, val
+				obj.attrs = make(map[string]string)
+			}
+			if prev, ok := obj.attrs[name]; ok {
+				val = prev + " " + val
+			}
+			obj.attrs[name] = val
+			last = name
+		}
+	}
+	flush()
+	return scanner.Err()
+}
+
+// ReadRPSL reads an RPSL database dump, such as ripe.db.inetnum.
+// inetnum and inet6num objects match by netname, descr or the name of
+// their organisation, route and route6 objects by origin ASN.
+func (s *RIRScanner) ReadRPSL(in io.Reader) error {
+	return readRPSL(in, func(obj rpslObject) {
+		source := strings.ToLower(obj.attrs["source"])
+		meta := Metadata{
+			Category: CategoryHosting,
+			Service:  obj.attrs["netname"],
+			Source:   source,
+			Country:  strings.ToUpper(firstField(obj.attrs["country"])),
+		}
+		switch obj.class {
+		case "organisation", "organization":
+			if rule := s.matchKeyword(obj.attrs["org-name"]); rule != -1 {
+				s.orgs[obj.key] = rule
+			}
+		case "inetnum", "inet6num":
+			rule := s.matchKeyword(obj.attrs["netname"], obj.attrs["descr"])
+			if r, ok := s.orgs[obj.attrs["org"]]; rule == -1 && ok {
+				rule = r
+			}
+			if rule == -1 {
+				return
+			}
+			left, right, ok := parseRPSLRange(obj.key)
+			if !ok {
+				s.Skipped++
+				return
+			}
+			s.add(rule, left, right, meta)
+		case "route", "route6":
+			asn, err := parseASN(obj.attrs["origin"])
+			if err != nil {
+				return
+			}
+			rule := s.matchASN(uint64(asn), 1)
+			if rule == -1 {
+				return
+			}
+			p, err := netip.ParsePrefix(obj.key)
+			if err != nil {
+				s.Skipped++
+				return
+			}
+			left, right := prefixRange(p.Masked())
+			meta.ASN = asn
+			meta.Service = ""
+			s.add(rule, left.Addr(), right.Addr(), meta)
+		}
+	})
+}
+
+// firstField returns the first space separated field of s, for
+// attributes that were repeated
+func firstField(s string) string {
+	f, _, _ := strings.Cut(strings.TrimSpace(s), " ")
+	return f
+}
+
+// parseRPSLRange parses an inetnum "192.0.2.0 - 192.0.2.255" or an
+// inet6num prefix
+func parseRPSLRange(key string) (netip.Addr, netip.Addr, bool) {
+	if l, r, ok := strings.Cut(key, "-"); ok {
+		left, err1 := netip.ParseAddr(strings.TrimSpace(l))
+		right, err2 := netip.ParseAddr(strings.TrimSpace(r))
+		return left, right, err1 == nil && err2 == nil
+	}
+	p, err := netip.ParsePrefix(strings.TrimSpace(key))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, false
+	}
+	left, right := prefixRange(p.Masked())
+	return left.Addr(), right.Addr(), true
+}
+
+// ReadDelegated reads a delegated-*-extended statistics file, with
+// records such as
+//
+//	ripencc|DE|ipv4|5.9.0.0|65536|20120207|allocated|5c8b5f4c-...
+//
+// Address records match if the same opaque-id holds a rule's ASN.
+func (s *RIRScanner) ReadDelegated(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		f := strings.Split(text, "|")
+		// skip the version line, summary lines and non-extended files
+		if len(f) < 8 || f[1] == "*" {
+			continue
+		}
+		registry, cc, typ, start, value, opaque := f[0], f[1], f[2], f[3], f[4], f[7]
+		if opaque == "" {
+			continue
+		}
+		switch typ {
+		case "asn":
+			first, err1 := strconv.ParseUint(start, 10, 32)
+			count, err2 := strconv.ParseUint(value, 10, 32)
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("line %d: invalid asn record %q", line, text)
+			}
+			if rule := s.matchASN(first, count); rule != -1 {
+				s.holders[opaque] = rule
+			}
+		case "ipv4", "ipv6":
+			rule, ok := s.holders[opaque]
+			if !ok {
+				continue
+			}
+			left, right, err := delegatedRange(typ, start, value)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+			s.add(rule, left, right, Metadata{
+				Category: CategoryHosting,
+				Source:   registry,
+				Country:  cc,
+			})
+		}
+	}
+	return scanner.Err()
+}
+
+// delegatedRange converts a delegated address record to a range.  For
+// IPv4 the value is the number of addresses, for IPv6 the prefix
+// length.
+func delegatedRange(typ, start, value string) (netip.Addr, netip.Addr, error) {
+	addr, err := netip.ParseAddr(start)
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("Unable to convert %s", start)
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n == 0 {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("Invalid value %q", value)
+	}
+	if typ == "ipv6" {
+		p, err := addr.Prefix(int(n))
+		if err != nil {
+			return netip.Addr{}, netip.Addr{}, err
+		}
+		left, right := prefixRange(p)
+		return left.Addr(), right.Addr(), nil
+	}
+	last := Uint128FromAddr(addr).Lo&0xffffffff + n - 1
+	if !addr.Is4() || last > 0xffffffff {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("Invalid range %s %s", start, value)
+	}
+	return addr, Uint128FromV4(uint32(last)).Addr(), nil
+}
+
+// Candidates returns the candidate ranges not already covered by a
+// record of the same provider in existing, which may be nil.  Where
+// candidates overlap, the smaller range is kept and the larger one is
+// cut into the fragments around it.
+func (s *RIRScanner) Candidates(existing *IntervalSet) (*IntervalSet, error) {
+	out := NewIntervalSet(s.candidates.Len())
+	s.candidates.SetOverlapPolicy(OverlapMostSpecific)
+	if err := s.candidates.sort(); err != nil {
+		return nil, err
+	}
+	for _, rec := range s.candidates.btree {
+		if existing != nil {
+			have, err := existing.LookupAddr(rec.LeftAddr())
+			if err != nil {
+				return nil, err
+			}
+			if have != nil && !have.Right.Less(rec.Right) &&
+				existing.canonicalName(have.Name) == existing.canonicalName(rec.Name) {
+				continue
+			}
+		}
+		if err := out.AddInterval(rec); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
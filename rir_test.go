@@ -0,0 +1,116 @@
+package ipcat
+
+import (
+	"strings"
+	"testing"
+)
+
+const rirRulesSample = `# name,url,keywords and ASNs
+Hetzner Online,https://www.hetzner.com/,hetzner,AS24940
+Example Hosting,https://example.com/,examplehost
+`
+
+const rpslSample = `% This is the RIPE Database dump.
+
+organisation:   ORG-HOA1-RIPE
+org-name:       Hetzner Online GmbH
+source:         RIPE
+
+inetnum:        5.9.0.0 - 5.9.255.255
+netname:        DE-HETZNER-20120207
+descr:          Datacenter
+org:            ORG-HOA1-RIPE
+country:        DE
+source:         RIPE
+
+inetnum:        192.0.2.0 - 192.0.2.127
+netname:        CUSTOMER-NET
+descr:          Hosted by
++               ExampleHost Ltd
+country:        GB
+source:         RIPE
+
+inetnum:        198.51.100.0 - 198.51.100.255
+netname:        UNRELATED
+country:        FR
+source:         RIPE
+
+inet6num:       2a01:4f8::/29
+netname:        DE-HETZNER-20060119
+org:            ORG-HOA1-RIPE
+country:        DE
+source:         RIPE
+
+route:          88.198.0.0/16
+origin:         AS24940
+source:         RIPE
+`
+
+const delegatedSample = `2|afrinic|20261017|5|19700101|20261016|+0000
+afrinic|*|asn|*|2|summary
+afrinic|*|ipv4|*|2|summary
+afrinic|ZA|asn|24940|1|20100101|allocated|F36A1B2C
+afrinic|ZA|ipv4|41.0.0.0|1024|20100101|allocated|F36A1B2C
+afrinic|KE|ipv4|41.10.0.0|768|20100101|allocated|0000AAAA
+afrinic|ZA|ipv6|2c0f:f000::|32|20100101|allocated|F36A1B2C
+`
+
+func TestRIRScanner(t *testing.T) {
+	rules, err := ParseRIRRules(strings.NewReader(rirRulesSample))
+	if err != nil {
+		t.Fatalf("ParseRIRRules error: %s", err)
+	}
+	if len(rules) != 2 || len(rules[0].ASNs) != 1 || rules[0].ASNs[0] != 24940 || rules[1].Keywords[0] != "examplehost" {
+		t.Fatalf("ParseRIRRules() = %+v", rules)
+	}
+
+	s := NewRIRScanner(rules)
+	if err := s.ReadRPSL(strings.NewReader(rpslSample)); err != nil {
+		t.Fatalf("ReadRPSL error: %s", err)
+	}
+	if err := s.ReadDelegated(strings.NewReader(delegatedSample)); err != nil {
+		t.Fatalf("ReadDelegated error: %s", err)
+	}
+
+	existing := NewIntervalSet(10)
+	existing.AddCIDR("88.198.0.0/16", "Hetzner Online", "https://www.hetzner.com/")
+	candidates, err := s.Candidates(existing)
+	if err != nil {
+		t.Fatalf("Candidates error: %s", err)
+	}
+
+	for _, tt := range []struct {
+		ip      string
+		name    string
+		country string
+		source  string
+	}{
+		{"5.9.1.1", "Hetzner Online", "DE", "ripe"},
+		{"192.0.2.1", "Example Hosting", "GB", "ripe"},
+		{"2a01:4f8::1", "Hetzner Online", "DE", "ripe"},
+		{"41.0.3.255", "Hetzner Online", "ZA", "afrinic"},
+		{"2c0f:f000::1", "Hetzner Online", "ZA", "afrinic"},
+		{"88.198.1.1", "", "", ""},
+		{"198.51.100.1", "", "", ""},
+		{"41.0.4.0", "", "", ""},
+		{"41.10.0.1", "", "", ""},
+	} {
+		rec, err := candidates.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("Contains(%q) error: %s", tt.ip, err)
+		}
+		if tt.name == "" {
+			if rec != nil {
+				t.Errorf("Contains(%q) = %v, want no candidate", tt.ip, rec)
+			}
+			continue
+		}
+		if rec == nil {
+			t.Errorf("Contains(%q) = nil, want %s candidate", tt.ip, tt.name)
+			continue
+		}
+		if rec.Name != tt.name || rec.Country != tt.country || rec.Source != tt.source || rec.Category != CategoryHosting {
+			t.Errorf("Contains(%q) = %+v, want %s %s %s", tt.ip, rec, tt.name, tt.country, tt.source)
+		}
+	}
+}
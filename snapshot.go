@@ -0,0 +1,89 @@
+package ipcat
+
+import (
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+)
+
+// Snapshot is a frozen, read-only copy of an IntervalSet.  Unlike
+// IntervalSet it is safe for concurrent lookups from many goroutines.
+// A nil *Snapshot is empty.
+type Snapshot struct {
+	list intervallist
+}
+
+// Snapshot sorts the set and returns a frozen copy of it.  Later
+// changes to the set do not affect the snapshot.
+func (ipset *IntervalSet) Snapshot() (*Snapshot, error) {
+	if err := ipset.sort(); err != nil {
+		return nil, err
+	}
+	list := make(intervallist, len(ipset.btree))
+	copy(list, ipset.btree)
+	return &Snapshot{list: list}, nil
+}
+
+// Len returns the number of elements in the snapshot
+func (s *Snapshot) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.list)
+}
+
+// LookupAddr returns a copy of the record containing the address, and
+// false if there is none.  It does not allocate.
+func (s *Snapshot) LookupAddr(addr netip.Addr) (Interval, bool) {
+	if s == nil || !addr.IsValid() {
+		return Interval{}, false
+	}
+	i := s.list.search(Uint128FromAddr(addr))
+	if i < 0 {
+		return Interval{}, false
+	}
+	return s.list[i], true
+}
+
+// Contains returns a copy of the record containing the IP address,
+// and false if there is none.  An error is returned for invalid input.
+func (s *Snapshot) Contains(dots string) (Interval, bool, error) {
+	addr, err := netip.ParseAddr(dots)
+	if err != nil {
+		return Interval{}, false, fmt.Errorf("Invalid input: %q", dots)
+	}
+	rec, ok := s.LookupAddr(addr)
+	return rec, ok, nil
+}
+
+// AtomicSnapshot holds a Snapshot that can be replaced while lookups
+// are in flight, without locks on the lookup path.  The zero value is
+// ready to use and holds an empty snapshot.
+type AtomicSnapshot struct {
+	p atomic.Pointer[Snapshot]
+}
+
+// Load returns the current snapshot, or nil if none was stored
+func (a *AtomicSnapshot) Load() *Snapshot {
+	return a.p.Load()
+}
+
+// Store replaces the current snapshot
+func (a *AtomicSnapshot) Store(s *Snapshot) {
+	a.p.Store(s)
+}
+
+// Swap replaces the current snapshot and returns the old one
+func (a *AtomicSnapshot) Swap(s *Snapshot) *Snapshot {
+	return a.p.Swap(s)
+}
+
+// LookupAddr looks up the address in the current snapshot
+func (a *AtomicSnapshot) LookupAddr(addr netip.Addr) (Interval, bool) {
+	return a.Load().LookupAddr(addr)
+}
+
+// Contains looks up the IP address in the current snapshot
+func (a *AtomicSnapshot) Contains(dots string) (Interval, bool, error) {
+	return a.Load().Contains(dots)
+}
@@ -0,0 +1,90 @@
+package ipcat
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	ipset := NewIntervalSet(10)
+	ipset.AddCIDR("10.0.0.0/16", "Ten", "")
+	snap, err := ipset.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() error: %s", err)
+	}
+
+	// changes to the set must not leak into the snapshot
+	ipset.DeleteByName("Ten")
+	ipset.AddCIDR("10.0.0.0/16", "Changed", "")
+
+	rec, ok, err := snap.Contains("10.0.1.1")
+	if err != nil {
+		t.Fatalf("Contains error: %s", err)
+	}
+	if !ok || rec.Name != "Ten" {
+		t.Errorf("Contains(%q) = %v, %v, want Ten", "10.0.1.1", rec, ok)
+	}
+	if _, _, err := snap.Contains("busted"); err == nil {
+		t.Errorf("Contains(%q) did not return an error", "busted")
+	}
+
+	var empty *Snapshot
+	if _, ok := empty.LookupAddr(netip.MustParseAddr("10.0.1.1")); ok || empty.Len() != 0 {
+		t.Errorf("nil Snapshot is not empty")
+	}
+
+	addr := netip.MustParseAddr("10.0.1.1")
+	allocs := testing.AllocsPerRun(100, func() {
+		snap.LookupAddr(addr)
+	})
+	if allocs != 0 {
+		t.Errorf("LookupAddr allocates %v times, want 0", allocs)
+	}
+}
+
+func TestAtomicSnapshot(t *testing.T) {
+	var holder AtomicSnapshot
+	addr := netip.MustParseAddr("10.0.1.1")
+	if _, ok := holder.LookupAddr(addr); ok {
+		t.Errorf("empty AtomicSnapshot found %s", addr)
+	}
+
+	snaps := make([]*Snapshot, 2)
+	for i, name := range []string{"First", "Second"} {
+		ipset := NewIntervalSet(1)
+		ipset.AddCIDR("10.0.0.0/16", name, "")
+		snap, err := ipset.Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot() error: %s", err)
+		}
+		snaps[i] = snap
+	}
+	holder.Store(snaps[0])
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				rec, ok := holder.LookupAddr(addr)
+				if !ok || (rec.Name != "First" && rec.Name != "Second") {
+					t.Errorf("LookupAddr(%s) = %v, %v", addr, rec, ok)
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		holder.Store(snaps[j%2])
+	}
+	wg.Wait()
+
+	if old := holder.Swap(snaps[1]); old != snaps[1] && old != snaps[0] {
+		t.Errorf("Swap() returned unknown snapshot")
+	}
+	if rec, _ := holder.LookupAddr(addr); rec.Name != "Second" {
+		t.Errorf("LookupAddr(%s) after Swap = %q, want Second", addr, rec.Name)
+	}
+}
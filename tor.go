@@ -0,0 +1,121 @@
+package ipcat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+var (
+	torDownload = "https://check.torproject.org/exit-addresses"
+)
+
+const (
+	torName = "Tor Exit Node"
+	torURL  = "https://www.torproject.org/"
+)
+
+func init() {
+	RegisterLayer("tor", TorProvider{})
+}
+
+// TorProvider is the Provider for Tor exit nodes
+type TorProvider struct{}
+
+// Name satisfies the Provider interface
+func (TorProvider) Name() string { return torName }
+
+// URL satisfies the Provider interface
+func (TorProvider) URL() string { return torURL }
+
+// Fetch satisfies the Provider interface
+func (TorProvider) Fetch(ctx context.Context, f *Fetcher) ([]byte, error) {
+	return f.Get(ctx, torDownload)
+}
+
+// Update satisfies the Provider interface
+func (TorProvider) Update(ipmap *IntervalSet, body []byte) error {
+	return UpdateTor(ipmap, body)
+}
+
+// DownloadTor downloads the latest Tor exit-addresses list
+func DownloadTor() ([]byte, error) {
+	return TorProvider{}.Fetch(context.Background(), nil)
+}
+
+// ParseTorExits parses the Tor Project's exit-addresses list, with
+// lines such as
+//
+//	ExitAddress 192.0.2.1 2026-10-17 17:01:58
+//
+// or the bulk exit list of one address per line, and returns when each
+// exit address was last seen.  The bulk list has no times, so they are
+// zero.
+func ParseTorExits(body []byte) (map[netip.Addr]time.Time, error) {
+	exits := make(map[netip.Addr]time.Time)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		f := strings.Fields(line)
+		var seen time.Time
+		switch {
+		case f[0] == "ExitAddress" && len(f) == 4:
+			t, err := time.Parse(time.DateTime, f[2]+" "+f[3])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid time in %q", line)
+			}
+			seen = t
+			f = f[1:2]
+		case len(f) == 1:
+			// bulk exit list
+		default:
+			// ExitNode, Published and LastStatus lines
+			continue
+		}
+		addr, err := netip.ParseAddr(f[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address in %q", line)
+		}
+		addr = addr.Unmap()
+		if prev, ok := exits[addr]; !ok || seen.After(prev) {
+			exits[addr] = seen
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return exits, nil
+}
+
+// UpdateTor parses a Tor exit list, see ParseTorExits, and updates the
+// interval set with one record per exit address, with the time it was
+// last seen.
+func UpdateTor(ipmap *IntervalSet, body []byte) error {
+	exits, err := ParseTorExits(body)
+	if err != nil {
+		return err
+	}
+
+	// delete all existing records
+	ipmap.DeleteByName(torName)
+
+	// and add back
+	for addr, seen := range exits {
+		err := ipmap.AddPrefixMeta(netip.PrefixFrom(addr, addr.BitLen()), torName, torURL, Metadata{
+			Category: CategoryTorExit,
+			Source:   "tor",
+			LastSeen: seen,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
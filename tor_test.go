@@ -0,0 +1,61 @@
+package ipcat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTor(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+	setHook(t, &torDownload, ts.URL+"/tor.txt")
+
+	b, err := DownloadTor()
+	if err != nil {
+		t.Fatalf("DownloadTor() error: %v", err)
+	}
+	ipset := NewIntervalSet(100)
+	ipset.AddCIDR("185.220.100.0/22", "Hosting", "")
+	ipset.SetOverlapPolicy(OverlapMostSpecific)
+	err = UpdateTor(ipset, b)
+	if err != nil {
+		t.Fatalf("UpdateTor error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		ip   string
+		name string
+		seen time.Time
+	}{
+		{"162.247.74.201", torName, time.Date(2026, 10, 17, 17, 1, 58, 0, time.UTC)},
+		{"185.220.101.1", torName, time.Date(2026, 10, 17, 13, 11, 40, 0, time.UTC)},
+		{"185.220.101.2", torName, time.Date(2026, 10, 17, 13, 11, 41, 0, time.UTC)},
+		{"185.220.101.3", "Hosting", time.Time{}},
+	} {
+		rec, err := ipset.Contains(tt.ip)
+		if err != nil {
+			t.Fatalf("ipset.Contains(%q) error: %v", tt.ip, err)
+		}
+		if rec == nil {
+			t.Errorf("ipset.Contains(%q) rec = nil, want exists", tt.ip)
+			continue
+		}
+		if rec.Name != tt.name || !rec.LastSeen.Equal(tt.seen) {
+			t.Errorf("ipset.Contains(%q) = %q %v, want %q %v", tt.ip, rec.Name, rec.LastSeen, tt.name, tt.seen)
+		}
+		if rec.Name == torName && rec.Category != CategoryTorExit {
+			t.Errorf("ipset.Contains(%q) category = %q, want %q", tt.ip, rec.Category, CategoryTorExit)
+		}
+	}
+
+	// the bulk exit list has no times
+	exits, err := ParseTorExits([]byte("# bulk\n162.247.74.201\n2001:db8::1\n"))
+	if err != nil {
+		t.Fatalf("ParseTorExits error: %v", err)
+	}
+	if len(exits) != 2 {
+		t.Errorf("ParseTorExits returned %d exits, want 2", len(exits))
+	}
+}
@@ -0,0 +1,201 @@
+package ipcat
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net"
+	"net/netip"
+)
+
+// Uint128 is a 128-bit unsigned integer used as the key for both IPv4
+// and IPv6 addresses.  IPv4 addresses are stored in their IPv4-mapped
+// IPv6 form (::ffff:a.b.c.d) so both families share one keyspace.
+type Uint128 struct {
+	Hi uint64
+	Lo uint64
+}
+
+// v4 prefix of an IPv4-mapped IPv6 address in the Hi/Lo representation
+const (
+	v4MappedHi = 0
+	v4MappedLo = 0xffff << 32
+)
+
+// Uint128FromIP converts a net.IP to a Uint128.  The boolean is false
+// if the address is not a valid IPv4 or IPv6 address.
+func Uint128FromIP(ip net.IP) (Uint128, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return Uint128{}, false
+	}
+	var u Uint128
+	for i := 0; i < 8; i++ {
+		u.Hi = u.Hi<<8 | uint64(ip[i])
+		u.Lo = u.Lo<<8 | uint64(ip[i+8])
+	}
+	return u, true
+}
+
+// Uint128FromV4 converts a uint32 IPv4 address to a Uint128
+func Uint128FromV4(val uint32) Uint128 {
+	return Uint128{Hi: v4MappedHi, Lo: v4MappedLo | uint64(val)}
+}
+
+// Uint128FromAddr converts a netip.Addr to a Uint128.  Any zone
+// is dropped.  The zero Addr converts to zero.
+func Uint128FromAddr(addr netip.Addr) Uint128 {
+	if !addr.IsValid() {
+		return Uint128{}
+	}
+	b := addr.As16()
+	return Uint128{
+		Hi: binary.BigEndian.Uint64(b[:8]),
+		Lo: binary.BigEndian.Uint64(b[8:]),
+	}
+}
+
+// Addr converts back to a netip.Addr.  IPv4-mapped values are
+// returned as plain IPv4 addresses.
+func (u Uint128) Addr() netip.Addr {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], u.Hi)
+	binary.BigEndian.PutUint64(b[8:], u.Lo)
+	return netip.AddrFrom16(b).Unmap()
+}
+
+// prefixRange returns the first and last address of a prefix
+func prefixRange(p netip.Prefix) (Uint128, Uint128) {
+	p = p.Masked()
+	left := Uint128FromAddr(p.Addr())
+	hostbits := p.Addr().BitLen() - p.Bits()
+	return left, left.or(Uint128{Hi: ^uint64(0), Lo: ^uint64(0)}.rsh(uint(128 - hostbits)))
+}
+
+// IP converts back to a 16-byte net.IP
+func (u Uint128) IP() net.IP {
+	ip := make(net.IP, net.IPv6len)
+	for i := 0; i < 8; i++ {
+		ip[i] = byte(u.Hi >> uint(56-8*i))
+		ip[i+8] = byte(u.Lo >> uint(56-8*i))
+	}
+	return ip
+}
+
+// Is4 returns true if the value is an IPv4-mapped address
+func (u Uint128) Is4() bool {
+	return u.Hi == v4MappedHi && u.Lo>>32 == v4MappedLo>>32
+}
+
+// String returns dotted notation for IPv4 and RFC 5952 notation for IPv6
+func (u Uint128) String() string {
+	return u.Addr().String()
+}
+
+// Less reports whether u < v
+func (u Uint128) Less(v Uint128) bool {
+	return u.Hi < v.Hi || (u.Hi == v.Hi && u.Lo < v.Lo)
+}
+
+// add1 returns u+1, wrapping around at the top of the range
+func (u Uint128) add1() Uint128 {
+	lo, carry := bits.Add64(u.Lo, 1, 0)
+	return Uint128{Hi: u.Hi + carry, Lo: lo}
+}
+
+// sub returns u-v, wrapping around on underflow
+func (u Uint128) sub(v Uint128) Uint128 {
+	lo, borrow := bits.Sub64(u.Lo, v.Lo, 0)
+	hi, _ := bits.Sub64(u.Hi, v.Hi, borrow)
+	return Uint128{Hi: hi, Lo: lo}
+}
+
+// or returns u | v
+func (u Uint128) or(v Uint128) Uint128 {
+	return Uint128{Hi: u.Hi | v.Hi, Lo: u.Lo | v.Lo}
+}
+
+// rsh returns u >> n
+func (u Uint128) rsh(n uint) Uint128 {
+	switch {
+	case n == 0:
+		return u
+	case n >= 128:
+		return Uint128{}
+	case n >= 64:
+		return Uint128{Lo: u.Hi >> (n - 64)}
+	}
+	return Uint128{Hi: u.Hi >> n, Lo: u.Lo>>n | u.Hi<<(64-n)}
+}
+
+// lsh returns u << n
+func (u Uint128) lsh(n uint) Uint128 {
+	switch {
+	case n == 0:
+		return u
+	case n >= 128:
+		return Uint128{}
+	case n >= 64:
+		return Uint128{Hi: u.Lo << (n - 64)}
+	}
+	return Uint128{Hi: u.Hi<<n | u.Lo>>(64-n), Lo: u.Lo << n}
+}
+
+// add returns u+v, wrapping around at the top of the range
+func (u Uint128) add(v Uint128) Uint128 {
+	lo, carry := bits.Add64(u.Lo, v.Lo, 0)
+	hi, _ := bits.Add64(u.Hi, v.Hi, carry)
+	return Uint128{Hi: hi, Lo: lo}
+}
+
+// bit returns bit n counting from the most significant bit
+func (u Uint128) bit(n int) int {
+	if n < 64 {
+		return int(u.Hi>>(63-uint(n))) & 1
+	}
+	return int(u.Lo>>(127-uint(n))) & 1
+}
+
+// trailingZeros returns the number of trailing zero bits, 128 for zero
+func (u Uint128) trailingZeros() int {
+	if u.Lo != 0 {
+		return bits.TrailingZeros64(u.Lo)
+	}
+	return 64 + bits.TrailingZeros64(u.Hi)
+}
+
+// leadingZeros returns the number of leading zero bits, 128 for zero
+func (u Uint128) leadingZeros() int {
+	if u.Hi != 0 {
+		return bits.LeadingZeros64(u.Hi)
+	}
+	return 64 + bits.LeadingZeros64(u.Lo)
+}
+
+// block is an aligned power of two range of addresses, the 128-bit
+// equivalent of a CIDR prefix
+type block struct {
+	start Uint128
+	bits  int
+}
+
+// blocks splits the closed interval [left,right] into the minimal list
+// of aligned blocks
+func blocks(left, right Uint128) []block {
+	var out []block
+	for {
+		// largest block that is aligned at left and fits in the interval
+		k := left.trailingZeros()
+		count := right.sub(left).add1()
+		if count != (Uint128{}) {
+			if fit := 127 - count.leadingZeros(); fit < k {
+				k = fit
+			}
+		}
+		out = append(out, block{start: left, bits: 128 - k})
+		end := left.add(Uint128{Lo: 1}.lsh(uint(k))).sub(Uint128{Lo: 1})
+		if !end.Less(right) {
+			return out
+		}
+		left = end.add1()
+	}
+}